@@ -0,0 +1,199 @@
+// Command gomud-admin inspects and fixes saved characters while the game is
+// offline. Characters are saved under a key derived from their name, so
+// they can't easily be found or edited by hand.
+//
+// Usage:
+//
+//	gomud-admin [-storage <backend>] [-storage-path <path>] <command> [arguments]
+//
+// The commands are:
+//
+//	list                           list every saved character
+//	show <character>               print a character as JSON
+//	password <character>           reset a password, read from stdin
+//	rename <character> <new name>  rename a character
+//	delete <character>             delete a character, after backing them up
+//	flag <character> <flag> <on|off>
+//	stat <character> <stat> <value>
+//
+// The game must not be running, or it may overwrite any change made here.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/construct"
+	"github.com/Cidan/gomud/storage"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	if err := config.Load(); err != nil {
+		log.Fatal().Err(err).Msg("Unable to read config file.")
+	}
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "gomud-admin:", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the command line and runs the command it names.
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("gomud-admin", flag.ContinueOnError)
+	backends := strings.Join(storage.Backends, ", ")
+	backend := flags.String("storage", config.GetString("storage"), "backend characters are saved in: "+backends)
+	path := flags.String("storage-path", config.GetString("storage_path"), "path of the backend, defaults to under save_path")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gomud-admin [-storage <backend>] [-storage-path <path>] <command> [arguments]")
+		fmt.Fprintln(flags.Output(), "Commands: list, show, password, rename, delete, flag, stat")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return errors.New("no command given")
+	}
+
+	config.Set("storage", *backend)
+	config.Set("storage_path", *path)
+	if err := construct.OpenStorage(); err != nil {
+		return fmt.Errorf("opening %s: %w", *backend, err)
+	}
+	defer construct.CloseStorage()
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "list":
+		return list(stdout)
+	case "show":
+		if len(args) != 1 {
+			return errors.New("usage: show <character>")
+		}
+		data, err := construct.CharacterJSON(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%s\n", data)
+		return nil
+	case "password":
+		if len(args) != 1 {
+			return errors.New("usage: password <character>")
+		}
+		return password(args[0], stdin, stdout)
+	case "rename":
+		if len(args) != 2 {
+			return errors.New("usage: rename <character> <new name>")
+		}
+		// The new name is checked against bans and reserved names, as it
+		// would be for a new character.
+		if err := construct.LoadBans(); err != nil {
+			return err
+		}
+		if err := construct.LoadReservedNames(); err != nil {
+			return err
+		}
+		if err := construct.RenameCharacter(args[0], args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Renamed %s to %s.\n", args[0], args[1])
+		return nil
+	case "delete":
+		if len(args) != 1 {
+			return errors.New("usage: delete <character>")
+		}
+		if err := construct.DeleteCharacter(args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Deleted %s. They can be brought back with restore in game.\n", args[0])
+		return nil
+	case "flag":
+		if len(args) != 3 || (args[2] != "on" && args[2] != "off") {
+			return errors.New("usage: flag <character> <flag> <on|off>")
+		}
+		if err := construct.SetCharacterFlag(args[0], args[1], args[2] == "on"); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Turned %s %s for %s.\n", args[1], args[2], args[0])
+		return nil
+	case "stat":
+		if len(args) != 3 {
+			return errors.New("usage: stat <character> <stat> <value>")
+		}
+		value, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s is not a number", args[2])
+		}
+		if err := construct.SetCharacterStat(args[0], args[1], value); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Set %s to %d for %s.\n", args[1], value, args[0])
+		return nil
+	default:
+		flags.Usage()
+		return fmt.Errorf("no such command %s", command)
+	}
+}
+
+// list prints every saved character.
+func list(stdout io.Writer) error {
+	characters, err := construct.Characters()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tACCOUNT\tROLE\tRACE\tCLASS\tKEY")
+	var problems []*construct.Character
+	for _, c := range characters {
+		if c.Err != nil {
+			problems = append(problems, c)
+		}
+		if c.Name == "" {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Name, c.Account, c.Role, c.Race, c.Class, c.Key)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	// Damaged pfiles are listed by key, so they can be found and fixed.
+	for _, c := range problems {
+		fmt.Fprintf(stdout, "Unable to read %s: %s\n", c.Key, c.Err)
+	}
+	return nil
+}
+
+// password reads a new password for a character from stdin, so that it
+// doesn't end up in the shell history.
+func password(name string, stdin io.Reader, stdout io.Writer) error {
+	fmt.Fprintf(stdout, "New password for %s: ", name)
+	pw, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	pw = strings.TrimRight(pw, "\r\n")
+	if pw == "" {
+		return errors.New("no password given")
+	}
+	if err := construct.ResetPassword(name, pw); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "The password for %s has been reset.\n", name)
+	return nil
+}
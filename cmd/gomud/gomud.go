@@ -2,12 +2,16 @@ package main
 
 import (
 	"context"
-	"net/http"
+	"errors"
 	_ "net/http/pprof"
 	"os"
-	"runtime"
+	"path/filepath"
 	"time"
 
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/construct"
+	"github.com/Cidan/gomud/server"
+	"github.com/Cidan/gomud/util"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/thejerf/suture/v4"
@@ -15,50 +19,92 @@ import (
 
 func main() {
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	if os.Getenv("MUDDEBUG") != "" {
-		go startDebugServer()
-		go startGC()
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
-	}
-	ctx := context.Background()
-	sup := suture.NewSimple("gomud")
-	log.Info().Msg("starting supervisor")
-	if err := sup.Serve(ctx); err != nil {
-		panic(err)
+	if err := config.Load(); err != nil {
+		log.Fatal().Err(err).Msg("Unable to read config file.")
 	}
-
-	/*
-		ctx := lock.Context(context.Background(), "main")
-		err := construct.LoadRooms(ctx)
-		if err != nil {
-			panic(err)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(os.Args[2:]); err != nil {
+			log.Fatal().Err(err).Msg("Migration failed.")
 		}
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sup := suture.NewSimple("gomud")
 
-		if construct.Atlas.WorldSize() == 0 {
-			construct.Atlas.MakeDefaultRoomSet(ctx)
-		}
+	world := newWorldService(config.GetDuration("shutdown_timeout"))
+	sup.Add(world)
+	sup.Add(&snapshotService{world: world, interval: time.Hour})
+	// An autosave_interval of 0 turns the autosave off, leaving changes to
+	// be saved as players save, quit or the world shuts down.
+	if interval := config.GetDuration("autosave_interval"); interval > 0 {
+		sup.Add(&autosaveService{
+			world:    world,
+			interval: interval,
+			batch:    config.GetInt("autosave_batch"),
+		})
+	} else {
+		log.Warn().Dur("autosave_interval", interval).Msg("Autosave is disabled.")
+	}
+	sup.Add(&listenerService{
+		world:  world,
+		server: server.New(config.GetInt("port")),
+	})
+	if port := config.GetInt("websocket_port"); port != 0 {
+		sup.Add(&listenerService{
+			world:  world,
+			server: server.NewWebSocket(port, config.GetString("websocket_path")),
+		})
+	}
+	if port := config.GetInt("tls_port"); port != 0 {
+		sup.Add(&listenerService{
+			world:  world,
+			server: server.NewTLS(port, tlsPath("tls_cert", "cert.pem"), tlsPath("tls_key", "key.pem"), config.GetBool("tls_self_signed")),
+		})
+	}
 
-		server := server.New()
+	if os.Getenv("MUDDEBUG") != "" {
+		sup.Add(&debugService{addr: ":8472"})
+		sup.Add(&gcService{interval: 5 * time.Second})
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	}
 
-		log.Info().Msg("Gomud listening on port 4000.")
-		if err := server.Listen(4000); err != nil {
-			log.Panic().Err(err).Msg("Error while listening for new connections.")
-		}
-		log.Info().Msg("Server shutting down.")
-	*/
-}
+	// Count down to shutdown on interrupt or terminate, then cancel the
+	// supervisor context, which propagates shutdown to every service. A
+	// second signal skips the countdown.
+	signals := util.ShutdownChannel()
+	go func() {
+		sig := <-signals
+		log.Info().Str("signal", sig.String()).Msg("Server shutting down.")
+		cctx, skip := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-signals:
+				skip()
+			case <-cctx.Done():
+			}
+		}()
+		construct.Atlas.BeginShutdown(cctx, config.GetDuration("shutdown_countdown"))
+		skip()
+		cancel()
+	}()
 
-func startDebugServer() {
-	err := http.ListenAndServe(":8472", nil)
-	if err != nil {
-		panic(err)
+	log.Info().Msg("starting supervisor")
+	err := sup.Serve(ctx)
+	// The supervisor doesn't wait for services to finish stopping, so make
+	// sure the world has been saved before we exit.
+	world.Wait()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatal().Err(err).Msg("supervisor exited")
 	}
+	log.Info().Msg("Shutdown complete.")
 }
 
-func startGC() {
-	for {
-		runtime.GC()
-		time.Sleep(5 * time.Second)
+// tlsPath returns the configured path for a TLS file, defaulting to a file
+// under the tls directory of the save path.
+func tlsPath(key, name string) string {
+	if path := config.GetString(key); path != "" {
+		return path
 	}
+	return filepath.Join(config.GetString("save_path"), "tls", name)
 }
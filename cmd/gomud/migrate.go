@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/construct"
+	"github.com/Cidan/gomud/storage"
+)
+
+// migrate copies every player, account, room and game record from one
+// storage backend to another. The game should not be running while it
+// does, or anything saved during the copy may be lost.
+func migrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	backends := strings.Join(storage.Backends, ", ")
+	from := flags.String("from", config.GetString("storage"), "backend to copy from: "+backends)
+	to := flags.String("to", "", "backend to copy to: "+backends)
+	fromPath := flags.String("from-path", "", "path of the backend to copy from, defaults to under save_path")
+	toPath := flags.String("to-path", "", "path of the backend to copy to, defaults to under save_path")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gomud migrate -to <backend> [-from <backend>] [-from-path <path>] [-to-path <path>]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if *to == "" {
+		flags.Usage()
+		return fmt.Errorf("no backend to copy to")
+	}
+	if *fromPath == "" {
+		*fromPath = construct.StoragePath(*from)
+	}
+	if *toPath == "" {
+		*toPath = construct.StoragePath(*to)
+	}
+	if *from == *to && *fromPath == *toPath {
+		return fmt.Errorf("%s at %s is both the source and the destination", *from, *fromPath)
+	}
+
+	src, err := storage.Open(*from, *fromPath)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", *from, err)
+	}
+	defer src.Close()
+	dst, err := storage.Open(*to, *toPath)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", *to, err)
+	}
+	defer dst.Close()
+
+	copied, err := storage.Copy(dst, src)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "Copied %d records from %s at %s to %s at %s.\n", copied, *from, *fromPath, *to, *toPath)
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/Cidan/gomud/construct"
+	"github.com/Cidan/gomud/lock"
+	"github.com/rs/zerolog/log"
+	"github.com/thejerf/suture/v4"
+)
+
+// worldService loads the game world once and holds it for the lifetime of
+// the supervisor. Services that need the world to exist should wait on
+// ready before doing any work.
+type worldService struct {
+	ready   chan struct{}
+	stopped chan struct{}
+	loaded  bool
+	timeout time.Duration
+}
+
+func newWorldService(timeout time.Duration) *worldService {
+	return &worldService{
+		ready:   make(chan struct{}),
+		stopped: make(chan struct{}),
+		timeout: timeout,
+	}
+}
+
+func (w *worldService) String() string {
+	return "world"
+}
+
+// Serve loads all rooms from storage, creating the default room set for an
+// empty world. The world is only loaded once, a restart of this service
+// will simply wait for shutdown again. On shutdown, every player and room
+// is persisted before Serve returns.
+func (w *worldService) Serve(ctx context.Context) error {
+	if !w.loaded {
+		lctx := lock.Context(ctx, "world")
+		if err := construct.OpenStorage(); err != nil {
+			log.Error().Err(err).Msg("Unable to open storage.")
+			return suture.ErrTerminateSupervisorTree
+		}
+		if err := construct.LoadRooms(lctx); err != nil {
+			log.Error().Err(err).Msg("Unable to load the game world.")
+			// There's no game to be played without a world, so bring
+			// everything down.
+			return suture.ErrTerminateSupervisorTree
+		}
+
+		if construct.Atlas.WorldSize() == 0 {
+			construct.Atlas.MakeDefaultRoomSet(lctx)
+		}
+		log.Info().Int64("rooms", construct.Atlas.WorldSize()).Msg("World loaded.")
+		if err := construct.LoadCreationTables(); err != nil {
+			log.Error().Err(err).Msg("Unable to load the race and class tables.")
+			return suture.ErrTerminateSupervisorTree
+		}
+		if err := construct.LoadBans(); err != nil {
+			log.Error().Err(err).Msg("Unable to load the ban list.")
+			return suture.ErrTerminateSupervisorTree
+		}
+		if err := construct.LoadReservedNames(); err != nil {
+			log.Error().Err(err).Msg("Unable to load the reserved names.")
+			return suture.ErrTerminateSupervisorTree
+		}
+		// Pick up any players handed to us by a reboot.
+		if err := construct.RestoreCopyover(); err != nil {
+			log.Error().Err(err).Msg("Unable to restore players after reboot.")
+		}
+		w.loaded = true
+		close(w.ready)
+	}
+
+	<-ctx.Done()
+	log.Info().Msg("Saving the world.")
+	if err := construct.Atlas.Persist(w.timeout); err != nil {
+		log.Error().Err(err).Msg("Unable to save the world on shutdown.")
+	}
+	if err := construct.CloseStorage(); err != nil {
+		log.Error().Err(err).Msg("Unable to close storage.")
+	}
+	close(w.stopped)
+	return ctx.Err()
+}
+
+// Wait blocks until the world has been persisted after shutdown. It returns
+// immediately if the world was never loaded.
+func (w *worldService) Wait() {
+	select {
+	case <-w.ready:
+		<-w.stopped
+	default:
+	}
+}
+
+// listenerService accepts player connections once the world is ready.
+// A failed listener is returned to the supervisor, which restarts it.
+type listenerService struct {
+	world  *worldService
+	server suture.Service
+}
+
+func (l *listenerService) String() string {
+	if s, ok := l.server.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return "listener"
+}
+
+func (l *listenerService) Serve(ctx context.Context) error {
+	select {
+	case <-l.world.ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return l.server.Serve(ctx)
+}
+
+// autosaveService saves the players and rooms that have changed. Each tick
+// saves a batch of them, so that a burst of changes is written out over
+// several ticks rather than all at once.
+type autosaveService struct {
+	world    *worldService
+	interval time.Duration
+	batch    int
+}
+
+func (a *autosaveService) String() string {
+	return "autosave"
+}
+
+func (a *autosaveService) Serve(ctx context.Context) error {
+	select {
+	case <-a.world.ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if saved := construct.FlushDirty(a.batch); saved > 0 {
+				log.Debug().Int("saved", saved).Int("waiting", construct.DirtyCount()).Msg("Autosaved.")
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// snapshotService takes the daily snapshot of the rooms. It checks on a
+// fixed interval, a snapshot is only taken once a day.
+type snapshotService struct {
+	world    *worldService
+	interval time.Duration
+}
+
+func (s *snapshotService) String() string {
+	return "snapshot"
+}
+
+func (s *snapshotService) Serve(ctx context.Context) error {
+	select {
+	case <-s.world.ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := construct.SnapshotRooms(); err != nil {
+			log.Error().Err(err).Msg("Unable to snapshot the rooms.")
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// debugService runs the pprof debug http server.
+type debugService struct {
+	addr string
+}
+
+func (d *debugService) String() string {
+	return "debug"
+}
+
+func (d *debugService) Serve(ctx context.Context) error {
+	srv := &http.Server{Addr: d.addr}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	err := srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// gcService forces a garbage collection on a fixed interval, used when
+// debugging memory usage.
+type gcService struct {
+	interval time.Duration
+}
+
+func (g *gcService) String() string {
+	return "gc"
+}
+
+func (g *gcService) Serve(ctx context.Context) error {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			runtime.GC()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"errors"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -10,10 +13,63 @@ var mutex sync.RWMutex
 
 func init() {
 	viper.AddConfigPath(".")
+	viper.SetConfigName("gomud")
+	viper.SetEnvPrefix("gomud")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
 	viper.SetDefault("save_path", "/tmp")
+	viper.SetDefault("storage", "file")
+	viper.SetDefault("storage_path", "")
+	viper.SetDefault("pfile_backups", 5)
+	viper.SetDefault("room_snapshots", 7)
+	viper.SetDefault("autosave_interval", "5s")
+	viper.SetDefault("autosave_batch", 20)
+	viper.SetDefault("port", 4000)
+	viper.SetDefault("websocket_port", 4001)
+	viper.SetDefault("websocket_path", "/")
+	viper.SetDefault("tls_port", 0)
+	viper.SetDefault("tls_cert", "")
+	viper.SetDefault("tls_key", "")
+	viper.SetDefault("tls_self_signed", true)
+	viper.SetDefault("shutdown_countdown", "10s")
+	viper.SetDefault("shutdown_timeout", "30s")
+	viper.SetDefault("idle_warn", "10m")
+	viper.SetDefault("idle_void", "15m")
+	viper.SetDefault("idle_disconnect", "30m")
+	viper.SetDefault("idle_editor_grace", "30m")
+	viper.SetDefault("linkdead_timeout", "5m")
+	viper.SetDefault("argon2_memory", 64*1024)
+	viper.SetDefault("argon2_time", 1)
+	viper.SetDefault("argon2_threads", 2)
+	viper.SetDefault("password_min_length", 8)
+	viper.SetDefault("password_deny_file", "")
+	viper.SetDefault("account_max_characters", 10)
+	viper.SetDefault("owner", "")
+	viper.SetDefault("creation_file", "")
+	viper.SetDefault("forbidden_names_file", "")
+	viper.SetDefault("connections_per_address", 5)
+	viper.SetDefault("login_backoff_base", "2s")
+	viper.SetDefault("login_backoff_max", "5m")
+	viper.SetDefault("login_lockout_failures", 5)
+	viper.SetDefault("login_lockout_duration", "15m")
+	viper.SetDefault("login_failure_reset", "1h")
 	mutex = sync.RWMutex{}
 }
 
+// Load reads the config file, gomud.yaml or any other format viper supports,
+// from the working directory. A missing config file is not an error, the
+// defaults and GOMUD_ environment variables are used instead.
+func Load() error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	err := viper.ReadInConfig()
+	var notFound viper.ConfigFileNotFoundError
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	return err
+}
+
 // Set will set a config value for the given key.
 func Set(key string, value interface{}) {
 	mutex.Lock()
@@ -27,3 +83,24 @@ func GetString(key string) string {
 	defer mutex.RUnlock()
 	return viper.GetString(key)
 }
+
+// GetInt gets a config key's value as an int.
+func GetInt(key string) int {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return viper.GetInt(key)
+}
+
+// GetBool gets a config key's value as a bool.
+func GetBool(key string) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return viper.GetBool(key)
+}
+
+// GetDuration gets a config key's value as a duration, i.e. "30s".
+func GetDuration(key string) time.Duration {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return viper.GetDuration(key)
+}
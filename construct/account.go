@@ -0,0 +1,225 @@
+package construct
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Cidan/gomud/storage"
+	"github.com/rs/zerolog/log"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Account is a login, which holds the credentials and owns one or more
+// characters. Accounts are saved separately from the characters they own.
+type Account struct {
+	Data  *accountData
+	mutex sync.RWMutex
+}
+
+// accountData is the saved part of an account. Flags are account wide
+// settings, which are applied to every character on the account as they
+// enter the world.
+type accountData struct {
+	Version    int
+	UUID       string
+	Name       string
+	Password   string
+	Characters []*accountCharacter
+	Flags      map[string]bool
+}
+
+// accountCharacter is a character owned by an account.
+type accountCharacter struct {
+	UUID string
+	Name string
+}
+
+// accountUUID returns the UUID for an account name. Account UUIDs are
+// derived from the name so that an account can be found by either.
+func accountUUID(name string) string {
+	return uuid.NewV5(uuid.NamespaceOID, "account:"+nameKey(name)).String()
+}
+
+// NewAccount constructs a new account with the given name.
+func NewAccount(name string) *Account {
+	return newAccountByUUID(accountUUID(name), name)
+}
+
+func newAccountByUUID(id, name string) *Account {
+	return &Account{
+		Data: &accountData{
+			Version: accountSchema.version(),
+			UUID:    id,
+			Name:    name,
+			Flags:   make(map[string]bool),
+		},
+	}
+}
+
+// Save an account to storage.
+func (a *Account) Save() error {
+	a.mutex.RLock()
+	data, err := json.Marshal(a.Data)
+	a.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+	return saveRecord(storage.Accounts, a.GetUUID(), data)
+}
+
+// Load an account from storage. Returns true if the account was loaded, and
+// false if no such account exists.
+func (a *Account) Load() (bool, error) {
+	data, err := loadRecord(storage.Accounts, a.GetUUID())
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if _, err := accountSchema.load(data, &a.Data); err != nil {
+		return false, err
+	}
+	if a.Data.Flags == nil {
+		a.Data.Flags = make(map[string]bool)
+	}
+	return true, nil
+}
+
+// GetUUID of an account.
+func (a *Account) GetUUID() string {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.Data.UUID
+}
+
+// GetName of an account.
+func (a *Account) GetName() string {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.Data.Name
+}
+
+// IsPassword takes an unhashed string and returns true if the input matches
+// the account password.
+func (a *Account) IsPassword(password string) bool {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return checkPassword(a.Data.Password, password)
+}
+
+// SetPassword takes an unhashed string and sets that as the account
+// password.
+func (a *Account) SetPassword(password string) {
+	hash := hashPassword(password)
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.Data.Password = hash
+}
+
+// upgradePassword re-hashes the account password with the current algorithm
+// and cost parameters if needed, given the unhashed password just used to
+// log in.
+func (a *Account) upgradePassword(password string) {
+	a.mutex.RLock()
+	needed := passwordNeedsRehash(a.Data.Password)
+	a.mutex.RUnlock()
+	if !needed {
+		return
+	}
+	a.SetPassword(password)
+	if err := a.Save(); err != nil {
+		log.Error().Err(err).Str("account", a.GetName()).Msg("Unable to save upgraded password.")
+		return
+	}
+	log.Info().Str("account", a.GetName()).Msg("Upgraded password hash.")
+}
+
+// Characters returns the characters owned by the account.
+func (a *Account) Characters() []*accountCharacter {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	list := make([]*accountCharacter, len(a.Data.Characters))
+	copy(list, a.Data.Characters)
+	return list
+}
+
+// Character finds a character on the account by name or by their number in
+// the character list, starting at 1.
+func (a *Account) Character(choice string) *accountCharacter {
+	list := a.Characters()
+	if n, err := strconv.Atoi(choice); err == nil {
+		if n < 1 || n > len(list) {
+			return nil
+		}
+		return list[n-1]
+	}
+	for _, c := range list {
+		if strings.EqualFold(c.Name, choice) {
+			return c
+		}
+	}
+	return nil
+}
+
+// AddCharacter adds a character to the account.
+func (a *Account) AddCharacter(id, name string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.Data.Characters = append(a.Data.Characters, &accountCharacter{UUID: id, Name: name})
+}
+
+// RemoveCharacter removes a character from the account by name.
+func (a *Account) RemoveCharacter(name string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for i, c := range a.Data.Characters {
+		if strings.EqualFold(c.Name, name) {
+			a.Data.Characters = append(a.Data.Characters[:i], a.Data.Characters[i+1:]...)
+			return
+		}
+	}
+}
+
+// RenameCharacter changes the name of a character on the account, found by
+// their UUID.
+func (a *Account) RenameCharacter(id, name string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, c := range a.Data.Characters {
+		if c.UUID == id {
+			c.Name = name
+		}
+	}
+}
+
+// Flags returns a copy of the account wide settings.
+func (a *Account) Flags() map[string]bool {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	flags := make(map[string]bool, len(a.Data.Flags))
+	for k, v := range a.Data.Flags {
+		flags[k] = v
+	}
+	return flags
+}
+
+// SetFlag sets an account wide setting.
+func (a *Account) SetFlag(key string, on bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.Data.Flags[key] = on
+}
+
+// ClearFlag removes an account wide setting, so each character keeps their
+// own.
+func (a *Account) ClearFlag(key string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.Data.Flags, key)
+}
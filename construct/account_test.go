@@ -0,0 +1,188 @@
+package construct
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Cidan/gomud/lock"
+	"github.com/Cidan/gomud/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// testConnect connects a new player and returns the client side of their
+// connection, with all output discarded.
+func testConnect(t *testing.T) (*bufio.Reader, *bufio.Writer) {
+	t.Helper()
+	client, server := net.Pipe()
+	p := NewPlayer()
+	ctx := lock.Context(p.Context(), p.Data.UUID+"incomming_conn")
+	p.SetConnection(ctx, server)
+	go p.Start()
+
+	reader := bufio.NewReader(client)
+	go func() {
+		for {
+			if _, err := reader.ReadString('\xf9'); err != nil {
+				return
+			}
+		}
+	}()
+	return reader, bufio.NewWriter(client)
+}
+
+// testLoadAccount loads an account from disk, returning nil if it doesn't
+// exist yet.
+func testLoadAccount(name string) *Account {
+	a := NewAccount(name)
+	if loaded, err := a.Load(); err != nil || !loaded {
+		return nil
+	}
+	return a
+}
+
+func TestAccountSaveAndLoad(t *testing.T) {
+	testSetupWorld(t)
+	a := NewAccount("Keeper")
+	a.SetPassword(testPassword)
+	a.AddCharacter("1", "First")
+	a.AddCharacter("2", "Second")
+	a.Data.Flags["color"] = false
+	assert.NoError(t, a.Save())
+
+	loaded := testLoadAccount("keeper")
+	assert.NotNil(t, loaded)
+	assert.True(t, loaded.IsPassword(testPassword))
+	assert.Equal(t, "First", loaded.Character("1").Name)
+	assert.Equal(t, "Second", loaded.Character("second").Name)
+	assert.Nil(t, loaded.Character("3"))
+	assert.Equal(t, map[string]bool{"color": false}, loaded.Flags())
+
+	loaded.RemoveCharacter("FIRST")
+	assert.Len(t, loaded.Characters(), 1)
+	assert.Nil(t, testLoadAccount("Nobody"))
+}
+
+func TestLegacyCharacterMigration(t *testing.T) {
+	testSetupWorld(t)
+	p := NewPlayer()
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+	p.SetName(ctx, "Oldtimer")
+	p.Data.Password = hashLegacyPassword("old password")
+	assert.NoError(t, p.Save(ctx))
+
+	_, w := testConnect(t)
+	runCommands(t, nil, w, []string{"Oldtimer", "old password", "Oldtimer"})
+	testFindPlayer(t, "Oldtimer")
+
+	a := testLoadAccount("Oldtimer")
+	assert.NotNil(t, a)
+	assert.True(t, a.IsPassword("old password"))
+	assert.False(t, isLegacyHash(a.Data.Password))
+	assert.Equal(t, p.Data.UUID, a.Character("Oldtimer").UUID)
+
+	data, found, err := loadPlayerData("Oldtimer")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, a.GetUUID(), data.Account)
+	assert.Empty(t, data.Password)
+}
+
+func TestAccountCreateAndDeleteCharacter(t *testing.T) {
+	testSetupWorld(t)
+	r, w := testLoginNewUser(t, "Multi")
+	runCommands(t, r, w, []string{"quit"})
+	assert.Eventually(t, func() bool {
+		return Atlas.GetPlayer("Multi") == nil
+	}, time.Second*5, time.Millisecond*10)
+
+	_, w = testConnect(t)
+	runCommands(t, nil, w, append([]string{"Multi", testPassword, "new", "Alt", "yes"}, testCreation...))
+	testFindPlayer(t, "Alt")
+	assert.True(t, characterExists("Alt"))
+	assert.Len(t, testLoadAccount("Multi").Characters(), 2)
+
+	_, w = testConnect(t)
+	runCommands(t, nil, w, []string{"Multi", testPassword, "delete 1", "Multi"})
+	assert.Eventually(t, func() bool {
+		return !characterExists("Multi")
+	}, time.Second*5, time.Millisecond*10)
+	a := testLoadAccount("Multi")
+	assert.Len(t, a.Characters(), 1)
+	assert.Equal(t, "Alt", a.Characters()[0].Name)
+}
+
+func TestAccountFlags(t *testing.T) {
+	testSetupWorld(t)
+	r, w := testLoginNewUser(t, "Painter")
+	p := testFindPlayer(t, "Painter")
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+	assert.Eventually(t, func() bool {
+		return p.IsInGame(ctx)
+	}, time.Second*5, time.Millisecond*10)
+	runCommands(t, r, w, []string{"prompt", "account prompt"})
+	// New characters have the prompt on, so turning it off shows that the
+	// account setting won.
+	assert.Eventually(t, func() bool {
+		on, ok := testLoadAccount("Painter").Flags()["prompt"]
+		return ok && !on
+	}, time.Second*5, time.Millisecond*10)
+	runCommands(t, r, w, []string{"quit"})
+	assert.Eventually(t, func() bool {
+		return Atlas.GetPlayer("Painter") == nil
+	}, time.Second*5, time.Millisecond*10)
+
+	// A character made afterwards picks the setting up as they log in.
+	_, w = testConnect(t)
+	runCommands(t, nil, w, append([]string{"Painter", testPassword, "new", "Easel", "yes"}, testCreation...))
+	p = testFindPlayer(t, "Easel")
+	ctx = lock.Context(p.Context(), p.Data.UUID+"test")
+	assert.Eventually(t, func() bool {
+		return p.IsInGame(ctx) && !p.ShowPrompt(ctx)
+	}, time.Second*5, time.Millisecond*10)
+
+	runCommands(t, nil, w, []string{"account prompt clear"})
+	assert.Eventually(t, func() bool {
+		_, ok := testLoadAccount("Painter").Flags()["prompt"]
+		return !ok
+	}, time.Second*5, time.Millisecond*10)
+}
+
+// accountFailingStore is a store that can't save accounts.
+type accountFailingStore struct {
+	*storage.Memory
+	tries *int32
+}
+
+func (f accountFailingStore) Put(kind storage.Kind, key string, data []byte) error {
+	if kind == storage.Accounts {
+		atomic.AddInt32(f.tries, 1)
+		return errors.New("disk full")
+	}
+	return f.Memory.Put(kind, key, data)
+}
+
+func TestCreateCharacterAccountSaveFails(t *testing.T) {
+	testSetupWorld(t)
+	mem := storage.NewMemory()
+	setStore(mem)
+	r, w := testLoginNewUser(t, "Founder")
+	runCommands(t, r, w, []string{"quit"})
+	assert.Eventually(t, func() bool {
+		return Atlas.GetPlayer("Founder") == nil
+	}, time.Second*5, time.Millisecond*10)
+
+	// The character isn't saved without their account, or the name would
+	// be taken by a character nobody can play.
+	var tries int32
+	setStore(accountFailingStore{mem, &tries})
+	_, w = testConnect(t)
+	runCommands(t, nil, w, append([]string{"Founder", testPassword, "new", "Orphan", "yes"}, testCreation...))
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&tries) > 0
+	}, time.Second*5, time.Millisecond*10)
+	assert.False(t, characterExists("Orphan"))
+}
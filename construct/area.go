@@ -0,0 +1,451 @@
+package construct
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/Cidan/gomud/storage"
+	"github.com/rs/zerolog/log"
+	uuid "github.com/satori/go.uuid"
+)
+
+// validAreaID matches the IDs areas may have. Areas are saved under their
+// ID, so it is kept to characters that are safe in a file name.
+var validAreaID = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// AreaData is the saved part of an area, other than its rooms.
+type AreaData struct {
+	Version     int
+	ID          string
+	Name        string
+	Description string
+	Credits     string
+	// Builders may build in the area. Anyone with the builder role may
+	// build in an area with no builders.
+	Builders []string
+	// Min and Max are opposite corners of the box rooms dug in the area
+	// fall within.
+	Min [3]int64
+	Max [3]int64
+}
+
+// areaFile is how an area is saved, with all of its rooms.
+type areaFile struct {
+	*AreaData
+	Rooms []json.RawMessage
+}
+
+// Area is a named group of rooms, saved and loaded as a unit.
+type Area struct {
+	mutex sync.RWMutex
+	Data  *AreaData
+	// rooms is the saved data of each room in the area, by UUID. Rooms are
+	// edited without a lock, so each room's data is taken as it changes
+	// rather than when the area is saved.
+	rooms map[string]json.RawMessage
+}
+
+// NewArea creates an empty area.
+func NewArea(id, name string) *Area {
+	return &Area{
+		Data: &AreaData{
+			Version: areaSchema.version(),
+			ID:      id,
+			Name:    name,
+		},
+		rooms: make(map[string]json.RawMessage),
+	}
+}
+
+// areaSchema migrates saved areas. Rooms in an area are migrated by the
+// room schema.
+var areaSchema = &schema{name: "area"}
+
+// GetID returns the area's ID.
+func (a *Area) GetID() string {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.Data.ID
+}
+
+// GetName returns the area's name.
+func (a *Area) GetName() string {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.Data.Name
+}
+
+// RoomCount returns the number of rooms in the area.
+func (a *Area) RoomCount() int {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return len(a.rooms)
+}
+
+// Contains returns true if the coordinates are within the area's box.
+func (a *Area) Contains(x, y, z int64) bool {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	for i, v := range [3]int64{x, y, z} {
+		if v < a.Data.Min[i] || v > a.Data.Max[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SetBounds sets the area's box from any two opposite corners.
+func (a *Area) SetBounds(from, to [3]int64) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for i := range from {
+		a.Data.Min[i], a.Data.Max[i] = from[i], to[i]
+		if from[i] > to[i] {
+			a.Data.Min[i], a.Data.Max[i] = to[i], from[i]
+		}
+	}
+}
+
+// CanBuild returns true if a character may build in the area. Admins may
+// always build.
+func (a *Area) CanBuild(name string, r role) bool {
+	if r >= roleAdmin {
+		return true
+	}
+	if r < roleBuilder {
+		return false
+	}
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if len(a.Data.Builders) == 0 {
+		return true
+	}
+	for _, b := range a.Data.Builders {
+		if nameKey(b) == nameKey(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ToggleBuilder adds a builder to the area, or removes them if they are
+// already one. Returns true if they were added.
+func (a *Area) ToggleBuilder(name string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for i, b := range a.Data.Builders {
+		if nameKey(b) == nameKey(name) {
+			a.Data.Builders = append(a.Data.Builders[:i], a.Data.Builders[i+1:]...)
+			return false
+		}
+	}
+	a.Data.Builders = append(a.Data.Builders, normalizeName(name))
+	return true
+}
+
+// info returns a copy of the area's data.
+func (a *Area) info() AreaData {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	d := *a.Data
+	d.Builders = append([]string(nil), a.Data.Builders...)
+	return d
+}
+
+// update changes the area's data with the area locked.
+func (a *Area) update(fn func(d *AreaData)) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	fn(a.Data)
+}
+
+// setRoom records the data of a room in the area.
+func (a *Area) setRoom(uuid string, data []byte) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.rooms[uuid] = data
+}
+
+// removeRoom drops a room from the area.
+func (a *Area) removeRoom(uuid string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.rooms, uuid)
+}
+
+// marshal returns the area as it is saved.
+func (a *Area) marshal() ([]byte, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	uuids := make([]string, 0, len(a.rooms))
+	for uuid := range a.rooms {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+	f := &areaFile{AreaData: a.Data}
+	for _, uuid := range uuids {
+		f.Rooms = append(f.Rooms, a.rooms[uuid])
+	}
+	return json.Marshal(f)
+}
+
+// Save writes the area and all of its rooms to storage.
+func (a *Area) Save() error {
+	data, err := a.marshal()
+	if err != nil {
+		return err
+	}
+	return saveRecord(storage.Areas, a.GetID(), data)
+}
+
+// markDirty queues the area to be saved by the autosave.
+func (a *Area) markDirty() {
+	queueSave("area:"+a.GetID(), &dirtyEntry{area: a})
+}
+
+// loadArea reads an area and its rooms from storage. The rooms are not yet
+// in the world.
+func loadArea(id string) (*Area, []*Room, error) {
+	raw, err := loadRecord(storage.Areas, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	f := &areaFile{AreaData: &AreaData{}}
+	migrated, err := areaSchema.load(raw, f)
+	if errors.Is(err, ErrCorrupt) {
+		reportCorrupt("Area "+id, storage.Areas, id, raw, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.ID != id {
+		return nil, nil, fmt.Errorf("area %s is saved as %s", f.ID, id)
+	}
+	a := NewArea(id, f.Name)
+	a.Data = f.AreaData
+	var rooms []*Room
+	for i, rawRoom := range f.Rooms {
+		room := NewRoom()
+		roomMigrated, err := roomSchema.load(rawRoom, &room.Data)
+		if errors.Is(err, ErrCorrupt) {
+			// One bad room shouldn't take the rest of the area down with
+			// it. It is quarantined on its own, and the area is saved
+			// again without it.
+			key := corruptRoomKey(id, i, rawRoom)
+			reportCorrupt(fmt.Sprintf("Room %s in area %s", key, id), storage.Rooms, key, rawRoom, err)
+			migrated = true
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("area %s: %w", id, err)
+		}
+		migrated = migrated || roomMigrated
+		room.Data.Area = id
+		data, err := json.Marshal(room.Data)
+		if err != nil {
+			return nil, nil, err
+		}
+		a.rooms[room.Data.UUID] = data
+		rooms = append(rooms, room)
+	}
+	if migrated {
+		if err := a.Save(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return a, rooms, nil
+}
+
+// corruptRoomKey returns the key a room that couldn't be loaded from an
+// area is quarantined under. This is its UUID if that can still be read,
+// otherwise its place in the area.
+func corruptRoomKey(area string, i int, raw []byte) string {
+	var r struct{ UUID string }
+	if err := json.Unmarshal(raw, &r); err == nil {
+		if id, err := uuid.FromString(r.UUID); err == nil {
+			return id.String()
+		}
+	}
+	return fmt.Sprintf("%s.%d", area, i)
+}
+
+// loadAreas loads every saved area and its rooms into the world.
+func loadAreas() error {
+	ids, err := recordKeys(storage.Areas)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		// Like a room, an area that can't be loaded is left out of the
+		// world.
+		a, rooms, err := loadArea(id)
+		if err != nil {
+			log.Error().Err(err).Str("area", id).Msg("Unable to load area, leaving it out of the world.")
+			continue
+		}
+		Atlas.AddArea(a)
+		for _, room := range rooms {
+			Atlas.AddRoom(room)
+		}
+		log.Debug().Str("area", id).Int("rooms", len(rooms)).Msg("loaded area")
+	}
+	return nil
+}
+
+// LoadArea loads an area that isn't in the world yet, such as one copied
+// in from another game. None of its rooms may already be in the world.
+func LoadArea(ctx context.Context, id string) (*Area, error) {
+	if Atlas.GetArea(id) != nil {
+		return nil, fmt.Errorf("area %s is already loaded", id)
+	}
+	a, rooms, err := loadArea(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, room := range rooms {
+		if Atlas.GetRoomByUUID(room.Data.UUID) != nil {
+			return nil, fmt.Errorf("room %s is already in the world", room.Data.UUID)
+		}
+		if Atlas.GetRoom(room.Data.X, room.Data.Y, room.Data.Z) != nil {
+			return nil, fmt.Errorf("there is already a room at %s", room.GetIndex())
+		}
+	}
+	Atlas.AddArea(a)
+	for _, room := range rooms {
+		Atlas.AddRoom(room)
+	}
+	Atlas.linkExits(ctx)
+	return a, nil
+}
+
+// ReloadArea throws away an area's rooms as they are in the world and loads
+// them again from storage. Rooms that are no longer saved in the area are
+// removed from the world, so reloading fails if anyone is in one of them.
+func ReloadArea(ctx context.Context, id string) (*Area, error) {
+	current := Atlas.GetArea(id)
+	if current == nil {
+		return nil, fmt.Errorf("area %s is not loaded", id)
+	}
+	a, rooms, err := loadArea(id)
+	if err != nil {
+		return nil, err
+	}
+	saved := make(map[string]*Room, len(rooms))
+	for _, room := range rooms {
+		saved[room.Data.UUID] = room
+		if existing := Atlas.GetRoomByUUID(room.Data.UUID); existing != nil && existing.Data.Area != id {
+			return nil, fmt.Errorf("room %s is in another area", room.Data.UUID)
+		}
+	}
+	var removed []*Room
+	for _, room := range Atlas.AreaRooms(id) {
+		if _, ok := saved[room.Data.UUID]; ok {
+			continue
+		}
+		if room.PlayerCount(ctx) > 0 {
+			return nil, fmt.Errorf("someone is in %s, which is no longer in the area", room.GetName())
+		}
+		removed = append(removed, room)
+	}
+
+	for _, room := range removed {
+		Atlas.removeRoom(room)
+	}
+	for _, room := range rooms {
+		existing := Atlas.GetRoomByUUID(room.Data.UUID)
+		if existing == nil {
+			Atlas.AddRoom(room)
+			continue
+		}
+		// Keep the room players are in, and give it the saved data.
+		Atlas.moveRoom(existing, func() {
+			existing.lock.Lock(ctx)
+			existing.Data = room.Data
+			existing.lock.Unlock(ctx)
+		})
+	}
+	// The area itself is replaced, anything queued for the old one is
+	// dropped along with it.
+	forgetSave("area:" + id)
+	Atlas.AddArea(a)
+	Atlas.linkExits(ctx)
+	return a, nil
+}
+
+// setArea moves the room into an area, or out of any area if a is nil.
+// Both the area it leaves and the one it joins are saved.
+func (r *Room) setArea(a *Area) error {
+	var from *Area
+	if r.Data.Area != "" {
+		from = Atlas.GetArea(r.Data.Area)
+	}
+	if from == a {
+		return nil
+	}
+	// The room is saved where it is going before it is taken out of where
+	// it was, so a failed save never leaves it saved nowhere.
+	prev := r.Data.Area
+	r.Data.Area = ""
+	if a != nil {
+		r.Data.Area = a.GetID()
+	}
+	if err := r.Save(); err != nil {
+		if a != nil {
+			a.removeRoom(r.Data.UUID)
+		}
+		r.Data.Area = prev
+		return err
+	}
+	if from != nil {
+		from.removeRoom(r.Data.UUID)
+		return from.Save()
+	}
+	// The room is saved with its area from now on, so any loose save still
+	// queued for it would only bring the old record back.
+	forgetSave("room:" + r.Data.UUID)
+	return deleteRecord(storage.Rooms, r.Data.UUID)
+}
+
+// getArea returns the area the room is in, or nil if it isn't in one.
+func (r *Room) getArea() (*Area, error) {
+	if r.Data.Area == "" {
+		return nil, nil
+	}
+	a := Atlas.GetArea(r.Data.Area)
+	if a == nil {
+		return nil, fmt.Errorf("room %s is in area %s, which isn't loaded", r.Data.UUID, r.Data.Area)
+	}
+	return a, nil
+}
+
+// validAreaFormat returns an error if the area ID can't be used.
+func validAreaFormat(id string) error {
+	if !validAreaID.MatchString(id) {
+		return errors.New("area IDs are up to 32 lowercase letters, digits, dashes and underscores")
+	}
+	return nil
+}
+
+// parseCoordinates parses three whole numbers as a coordinate.
+func parseCoordinates(fields []string) ([3]int64, error) {
+	var c [3]int64
+	if len(fields) != 3 {
+		return c, errors.New("a coordinate is three numbers")
+	}
+	for i, f := range fields {
+		if _, err := fmt.Sscan(f, &c[i]); err != nil {
+			return c, fmt.Errorf("%s is not a number", f)
+		}
+	}
+	return c, nil
+}
+
+// formatCoordinates formats a coordinate for builders.
+func formatCoordinates(c [3]int64) string {
+	return fmt.Sprintf("%d,%d,%d", c[0], c[1], c[2])
+}
@@ -0,0 +1,171 @@
+package construct
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Cidan/gomud/lock"
+	"github.com/Cidan/gomud/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAreaCanBuild(t *testing.T) {
+	a := NewArea("keep", "The Keep")
+	assert.False(t, a.CanBuild("Mason", rolePlayer))
+	assert.True(t, a.CanBuild("Mason", roleBuilder))
+
+	assert.True(t, a.ToggleBuilder("mason"))
+	assert.True(t, a.CanBuild("Mason", roleBuilder))
+	assert.False(t, a.CanBuild("Carver", roleBuilder))
+	assert.True(t, a.CanBuild("Carver", roleAdmin))
+	assert.False(t, a.ToggleBuilder("Mason"))
+	assert.True(t, a.CanBuild("Carver", roleBuilder))
+
+	a.SetBounds([3]int64{5, 0, 1}, [3]int64{-5, 10, 1})
+	assert.True(t, a.Contains(-5, 10, 1))
+	assert.True(t, a.Contains(0, 5, 1))
+	assert.False(t, a.Contains(0, 5, 2))
+	assert.False(t, a.Contains(6, 5, 1))
+}
+
+func TestLoadArea(t *testing.T) {
+	testSetupWorld(t)
+	ctx := lock.Context(context.Background(), "test")
+
+	// An area copied in from elsewhere, with two rooms joined east to west.
+	a := NewArea("import", "Imported")
+	west, east := NewRoom(), NewRoom()
+	west.Data.X, west.Data.Y, west.Data.Z = 8000, 0, 0
+	east.Data.X, east.Data.Y, east.Data.Z = 8001, 0, 0
+	west.Data.DirectionExits[dirEast].Target = east.Data.UUID
+	east.Data.DirectionExits[dirWest].Target = west.Data.UUID
+	for _, room := range []*Room{west, east} {
+		room.Data.Area = a.GetID()
+		data, err := json.Marshal(room.Data)
+		assert.NoError(t, err)
+		a.setRoom(room.Data.UUID, data)
+	}
+	assert.NoError(t, a.Save())
+
+	loaded, err := LoadArea(ctx, "import")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, loaded.RoomCount())
+	assert.Len(t, Atlas.AreaRooms("import"), 2)
+	assert.Equal(t, loaded, Atlas.GetArea("import"))
+	room := Atlas.GetRoom(8000, 0, 0)
+	if assert.NotNil(t, room) {
+		assert.Equal(t, Atlas.GetRoom(8001, 0, 0), room.PhysicalRoom(dirEast))
+	}
+
+	_, err = LoadArea(ctx, "import")
+	assert.Error(t, err)
+	_, err = LoadArea(ctx, "missing")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+// areaFailingStore is a store that can't save areas.
+type areaFailingStore struct {
+	*storage.Memory
+}
+
+func (f areaFailingStore) Put(kind storage.Kind, key string, data []byte) error {
+	if kind == storage.Areas {
+		return errors.New("disk full")
+	}
+	return f.Memory.Put(kind, key, data)
+}
+
+func TestSetAreaFailedSave(t *testing.T) {
+	testSetupWorld(t)
+	mem := storage.NewMemory()
+	setStore(mem)
+	room := NewRoom()
+	room.Data.X, room.Data.Y, room.Data.Z = 8100, 0, 0
+	assert.NoError(t, room.Save())
+	a := NewArea("sunk", "Sunk")
+	Atlas.AddArea(a)
+
+	// The room can't be saved into the area, so it must stay saved where
+	// it was.
+	setStore(areaFailingStore{mem})
+	assert.Error(t, room.setArea(a))
+	assert.Empty(t, room.Data.Area)
+	assert.Equal(t, 0, a.RoomCount())
+	_, err := loadRecord(storage.Rooms, room.Data.UUID)
+	assert.NoError(t, err)
+}
+
+func TestAreaCommands(t *testing.T) {
+	testSetupWorld(t)
+	testResetAutosave(t)
+	room := NewRoom()
+	room.Data.X, room.Data.Y, room.Data.Z = 7000, 0, 0
+	room.Data.Name = "Gatehouse"
+	assert.NoError(t, room.Save())
+	Atlas.AddRoom(room)
+
+	testLoginNewUser(t, "Surveyor")
+	p := testFindPlayer(t, "Surveyor")
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+	assert.Eventually(t, func() bool {
+		return p.IsInGame(ctx)
+	}, time.Second*5, time.Millisecond*10)
+	p.setRole(ctx, roleBuilder)
+	p.ToRoom(ctx, room)
+
+	// Creating an area moves the room out of the loose rooms and into the
+	// area's record.
+	assert.NoError(t, p.buildInterp.Read(ctx, "area create gate The Gate"))
+	a := Atlas.GetArea("gate")
+	if !assert.NotNil(t, a) {
+		return
+	}
+	assert.Equal(t, "gate", room.Data.Area)
+	_, err := loadRecord(storage.Rooms, room.Data.UUID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = loadRecord(storage.Areas, "gate")
+	assert.NoError(t, err)
+
+	// Rooms dug inside the box join the area, and are saved with it.
+	assert.NoError(t, p.buildInterp.Read(ctx, "area set gate bounds 7000 0 0 7005 0 0"))
+	// A typo leaves the bounds as they were.
+	assert.NoError(t, p.buildInterp.Read(ctx, "area set gate bounds 0 0 0 10 x 5"))
+	assert.True(t, Atlas.GetArea("gate").Contains(7005, 0, 0))
+	assert.False(t, Atlas.GetArea("gate").Contains(10, 0, 5))
+	assert.NoError(t, p.buildInterp.Read(ctx, "dig east"))
+	dug := Atlas.GetRoom(7001, 0, 0)
+	if !assert.NotNil(t, dug) {
+		return
+	}
+	assert.Equal(t, "gate", dug.Data.Area)
+	assert.Len(t, Atlas.AreaRooms("gate"), 2)
+	FlushDirty(0)
+	_, rooms, err := loadArea("gate")
+	assert.NoError(t, err)
+	assert.Len(t, rooms, 2)
+	p.ToRoom(ctx, room)
+
+	// Reloading throws away changes that weren't saved, but keeps the
+	// rooms players are in.
+	room.SetName("Changed")
+	assert.NoError(t, p.buildInterp.Read(ctx, "area reload gate"))
+	assert.Equal(t, "Gatehouse", room.GetName())
+	assert.Equal(t, room, Atlas.GetRoomByUUID(room.Data.UUID))
+	assert.Equal(t, room, Atlas.GetRoom(7000, 0, 0))
+
+	// Only the area's builders may build in it once it has any.
+	assert.NoError(t, p.buildInterp.Read(ctx, "area builder gate Someone"))
+	assert.NoError(t, p.buildInterp.Read(ctx, "set room name Locked Out"))
+	assert.Equal(t, "Gatehouse", room.GetName())
+
+	// Rooms taken out of an area are saved loose again.
+	p.setRole(ctx, roleAdmin)
+	assert.NoError(t, p.buildInterp.Read(ctx, "area assign none"))
+	assert.Equal(t, "", room.Data.Area)
+	assert.Equal(t, 1, Atlas.GetArea("gate").RoomCount())
+	_, err = loadRecord(storage.Rooms, room.Data.UUID)
+	assert.NoError(t, err)
+}
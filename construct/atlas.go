@@ -3,16 +3,22 @@ package construct
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 )
 
 type AtlasData struct {
 	worldMap          map[string]*Room
 	worldRoomUUID     map[string]*Room
+	areas             map[string]*Area
 	allPlayers        map[string]*Player
 	worldSize         int64
+	shuttingDown      int32
+	void              *Room
+	voidOnce          sync.Once
 	worldMapMutex     sync.RWMutex
 	worldRoomMutex    sync.RWMutex
+	areasMutex        sync.RWMutex
 	allPlayersMutex   sync.RWMutex
 	roomModifierMutex sync.Mutex
 }
@@ -23,6 +29,7 @@ func init() {
 	Atlas = &AtlasData{
 		worldMap:          make(map[string]*Room),
 		worldRoomUUID:     make(map[string]*Room),
+		areas:             make(map[string]*Area),
 		allPlayers:        make(map[string]*Player),
 		worldMapMutex:     sync.RWMutex{},
 		worldRoomMutex:    sync.RWMutex{},
@@ -67,22 +74,136 @@ func (a *AtlasData) AddRoom(r *Room) {
 	a.worldRoomMutex.Unlock()
 }
 
+// removeRoom takes a room out of the game world.
+func (a *AtlasData) removeRoom(r *Room) {
+	a.worldMapMutex.Lock()
+	if a.worldMap[r.GetIndex()] == r {
+		delete(a.worldMap, r.GetIndex())
+	}
+	a.worldMapMutex.Unlock()
+
+	a.worldRoomMutex.Lock()
+	if a.worldRoomUUID[r.Data.UUID] == r {
+		delete(a.worldRoomUUID, r.Data.UUID)
+		a.worldSize--
+	}
+	a.worldRoomMutex.Unlock()
+}
+
+// moveRoom runs fn, which may change the coordinates of the room, and files
+// the room under its new coordinates.
+func (a *AtlasData) moveRoom(r *Room, fn func()) {
+	a.worldMapMutex.Lock()
+	defer a.worldMapMutex.Unlock()
+	if a.worldMap[r.GetIndex()] == r {
+		delete(a.worldMap, r.GetIndex())
+	}
+	fn()
+	a.worldMap[r.GetIndex()] = r
+}
+
+// linkExits points the exits of every room at the rooms they lead to.
+// Somewhat expensive in large worlds, but only needs to be done when rooms
+// are loaded. This allows for fast room movement without global lookups.
+func (a *AtlasData) linkExits(ctx context.Context) {
+	a.worldRoomMutex.RLock()
+	rooms := make([]*Room, 0, len(a.worldRoomUUID))
+	for _, room := range a.worldRoomUUID {
+		rooms = append(rooms, room)
+	}
+	a.worldRoomMutex.RUnlock()
+	for _, room := range rooms {
+		for _, dir := range exitDirections {
+			exit := room.Exit(ctx, dir)
+			if exit.Target != "" {
+				room.exitRooms[dir] = a.GetRoomByUUID(exit.Target)
+			}
+		}
+	}
+}
+
+// AddArea adds an area to the world, replacing any area with the same ID.
+func (a *AtlasData) AddArea(area *Area) {
+	a.areasMutex.Lock()
+	defer a.areasMutex.Unlock()
+	a.areas[area.GetID()] = area
+}
+
+// GetArea returns the area with the given ID, or nil if there is none.
+func (a *AtlasData) GetArea(id string) *Area {
+	a.areasMutex.RLock()
+	defer a.areasMutex.RUnlock()
+	return a.areas[id]
+}
+
+// Areas returns every area in the world, ordered by ID.
+func (a *AtlasData) Areas() []*Area {
+	a.areasMutex.RLock()
+	areas := make([]*Area, 0, len(a.areas))
+	for _, area := range a.areas {
+		areas = append(areas, area)
+	}
+	a.areasMutex.RUnlock()
+	sort.Slice(areas, func(i, j int) bool {
+		return areas[i].GetID() < areas[j].GetID()
+	})
+	return areas
+}
+
+// AreaAt returns the area whose box holds the given coordinates, or nil if
+// there is none. If boxes overlap, the area with the lowest ID wins.
+func (a *AtlasData) AreaAt(x, y, z int64) *Area {
+	for _, area := range a.Areas() {
+		if area.Contains(x, y, z) {
+			return area
+		}
+	}
+	return nil
+}
+
+// AreaRooms returns every room in the world that is in the given area.
+func (a *AtlasData) AreaRooms(id string) []*Room {
+	a.worldRoomMutex.RLock()
+	defer a.worldRoomMutex.RUnlock()
+	var rooms []*Room
+	for _, room := range a.worldRoomUUID {
+		if room.Data.Area == id {
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms
+}
+
 // AddPlayer adds a player to the global game state. Returns existing
 // player reference if the player already exists globally.
 func (a *AtlasData) AddPlayer(ctx context.Context, p *Player) *Player {
 	a.allPlayersMutex.Lock()
 	defer a.allPlayersMutex.Unlock()
-	if existingPlayer, ok := a.allPlayers[p.GetName(ctx)]; ok {
+	key := nameKey(p.GetName(ctx))
+	if existingPlayer, ok := a.allPlayers[key]; ok {
 		return existingPlayer
 	}
-	a.allPlayers[p.GetName(ctx)] = p
+	a.allPlayers[key] = p
 	return nil
 }
 
 func (a *AtlasData) RemovePlayer(ctx context.Context, p *Player) {
 	a.allPlayersMutex.Lock()
 	defer a.allPlayersMutex.Unlock()
-	delete(a.allPlayers, p.GetName(ctx))
+	key := nameKey(p.GetName(ctx))
+	// Only remove the player if they are the one in the world, a session
+	// that was taken over must not remove the one that took it over.
+	if a.allPlayers[key] == p {
+		delete(a.allPlayers, key)
+	}
+}
+
+// GetPlayer returns the player in the world with the given name, in any
+// case, or nil if they aren't in the world.
+func (a *AtlasData) GetPlayer(name string) *Player {
+	a.allPlayersMutex.RLock()
+	defer a.allPlayersMutex.RUnlock()
+	return a.allPlayers[nameKey(name)]
 }
 
 // WorldSize returns the number of rooms in the world.
@@ -0,0 +1,171 @@
+package construct
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Cidan/gomud/lock"
+	"github.com/Cidan/gomud/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// dirtyEntry is something waiting to be saved. Players are saved as they
+// are when the entry is flushed. Rooms are edited without their lock held,
+// so a room is queued with its data as it was when it changed.
+type dirtyEntry struct {
+	player *Player
+	area   *Area
+	room   string
+	data   []byte
+}
+
+// autosave is the queue of players and rooms that have changed since they
+// were last saved. Each is queued once, in the order they first changed.
+var autosave = struct {
+	mutex   sync.Mutex
+	order   []string
+	entries map[string]*dirtyEntry
+
+	// Failures are reported to admins at most once a minute, so a full
+	// disk doesn't flood them.
+	lastReport time.Time
+	suppressed int
+}{entries: make(map[string]*dirtyEntry)}
+
+// queueSave adds an entry to the autosave queue, replacing any entry with
+// the same key while keeping its place.
+func queueSave(key string, e *dirtyEntry) {
+	autosave.mutex.Lock()
+	defer autosave.mutex.Unlock()
+	if _, ok := autosave.entries[key]; !ok {
+		autosave.order = append(autosave.order, key)
+	}
+	autosave.entries[key] = e
+}
+
+// forgetSave drops an entry from the autosave queue.
+func forgetSave(key string) {
+	autosave.mutex.Lock()
+	defer autosave.mutex.Unlock()
+	delete(autosave.entries, key)
+}
+
+// markDirty queues the player to be saved by the autosave. Players that
+// are still logging in are not in the world yet, and aren't saved.
+func (p *Player) markDirty(ctx context.Context) {
+	p.lock.Lock(ctx)
+	inWorld := p.inRoom != nil && p.currentInterp != p.loginInterp
+	key := "player:" + p.Data.UUID
+	p.lock.Unlock(ctx)
+	if inWorld {
+		queueSave(key, &dirtyEntry{player: p})
+	}
+}
+
+// markDirty queues the room to be saved by the autosave, as it is now. A
+// room in an area queues its area instead.
+func (r *Room) markDirty() error {
+	data, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	a, err := r.getArea()
+	if err != nil {
+		return err
+	}
+	if a != nil {
+		a.setRoom(r.Data.UUID, data)
+		a.markDirty()
+		return nil
+	}
+	queueSave("room:"+r.Data.UUID, &dirtyEntry{room: r.Data.UUID, data: data})
+	return nil
+}
+
+// DirtyCount returns the number of players and rooms waiting to be saved.
+func DirtyCount() int {
+	autosave.mutex.Lock()
+	defer autosave.mutex.Unlock()
+	return len(autosave.entries)
+}
+
+// FlushDirty saves up to max of the players and rooms waiting to be saved,
+// oldest first, or all of them if max is 0. Anything that fails to save is
+// reported to admins and queued again. Returns the number saved.
+func FlushDirty(max int) int {
+	autosave.mutex.Lock()
+	var batch []*dirtyEntry
+	var keys []string
+	for len(autosave.order) > 0 && (max <= 0 || len(batch) < max) {
+		key := autosave.order[0]
+		autosave.order = autosave.order[1:]
+		e, ok := autosave.entries[key]
+		if !ok {
+			// Saved some other way since it was queued.
+			continue
+		}
+		delete(autosave.entries, key)
+		batch = append(batch, e)
+		keys = append(keys, key)
+	}
+	autosave.mutex.Unlock()
+
+	var saved int
+	for i, e := range batch {
+		var what string
+		var err error
+		if p := e.player; p != nil {
+			ctx := lock.Context(p.Context(), p.GetUUID(p.Context())+"autosave")
+			what = "player " + p.GetName(ctx)
+			err = p.autosave(ctx)
+		} else if a := e.area; a != nil {
+			what = "area " + a.GetID()
+			err = a.Save()
+		} else {
+			what = "room " + e.room
+			err = saveRecord(storage.Rooms, e.room, e.data)
+		}
+		if err != nil {
+			reportSaveFailure(what, err)
+			requeueSave(keys[i], e)
+			continue
+		}
+		saved++
+	}
+	return saved
+}
+
+// requeueSave puts an entry that failed to save back at the end of the
+// queue, unless it changed again in the meantime.
+func requeueSave(key string, e *dirtyEntry) {
+	autosave.mutex.Lock()
+	defer autosave.mutex.Unlock()
+	if _, ok := autosave.entries[key]; ok {
+		return
+	}
+	autosave.order = append(autosave.order, key)
+	autosave.entries[key] = e
+}
+
+// reportSaveFailure logs a failed save and tells the admins in the world.
+func reportSaveFailure(what string, err error) {
+	log.Error().Err(err).Str("what", what).Msg("Unable to save.")
+
+	autosave.mutex.Lock()
+	if time.Since(autosave.lastReport) < time.Minute {
+		autosave.suppressed++
+		autosave.mutex.Unlock()
+		return
+	}
+	msg := fmt.Sprintf("{RUnable to save %s: %s{x", what, err)
+	if autosave.suppressed > 0 {
+		msg = fmt.Sprintf("{RUnable to save %s: %s (and %d more failures, see the log){x", what, err, autosave.suppressed)
+	}
+	autosave.lastReport = time.Now()
+	autosave.suppressed = 0
+	autosave.mutex.Unlock()
+	alertAdmins("%s", msg)
+}
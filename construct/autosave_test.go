@@ -0,0 +1,112 @@
+package construct
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Cidan/gomud/lock"
+	"github.com/Cidan/gomud/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// testResetAutosave empties the autosave queue now and once the test is
+// done.
+func testResetAutosave(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		autosave.mutex.Lock()
+		defer autosave.mutex.Unlock()
+		autosave.order = nil
+		autosave.entries = make(map[string]*dirtyEntry)
+		autosave.lastReport = time.Time{}
+		autosave.suppressed = 0
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// failingStore is a store that can't save rooms.
+type failingStore struct {
+	*storage.Memory
+}
+
+func (f failingStore) Put(kind storage.Kind, key string, data []byte) error {
+	if kind == storage.Rooms {
+		return errors.New("disk full")
+	}
+	return f.Memory.Put(kind, key, data)
+}
+
+func TestAutosavePlayer(t *testing.T) {
+	testSetupWorld(t)
+	testLoginNewUser(t, "Dirty")
+	p := testFindPlayer(t, "Dirty")
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+	assert.Eventually(t, func() bool {
+		return p.IsInGame(ctx)
+	}, time.Second*5, time.Millisecond*10)
+	testResetAutosave(t)
+
+	before, err := playerBackups("Dirty")
+	assert.NoError(t, err)
+	p.ToggleFlag(ctx, "autobuild")
+	p.ModifyStat(ctx, "health", -5, true)
+	assert.Equal(t, 1, DirtyCount())
+	assert.Equal(t, 1, FlushDirty(0))
+	assert.Equal(t, 0, DirtyCount())
+	// The autosave doesn't rotate the backups.
+	after, err := playerBackups("Dirty")
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	data, found, err := loadPlayerData("Dirty")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.True(t, data.Flags["autobuild"])
+	assert.Equal(t, p.GetStat(ctx, "health"), data.Stats.Health)
+}
+
+func TestAutosaveBatches(t *testing.T) {
+	testSetupWorld(t)
+	testResetAutosave(t)
+	var rooms []*Room
+	for i := 0; i < 5; i++ {
+		room := NewRoom()
+		assert.NoError(t, room.markDirty())
+		rooms = append(rooms, room)
+	}
+	// A room changed again keeps its place and saves its latest data.
+	rooms[0].Data.Name = "Renamed"
+	assert.NoError(t, rooms[0].markDirty())
+	assert.Equal(t, 5, DirtyCount())
+
+	assert.Equal(t, 2, FlushDirty(2))
+	assert.Equal(t, 3, DirtyCount())
+	raw, err := loadRecord(storage.Rooms, rooms[0].Data.UUID)
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), "Renamed")
+	_, err = loadRecord(storage.Rooms, rooms[4].Data.UUID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	assert.Equal(t, 3, FlushDirty(2)+FlushDirty(2))
+	assert.Equal(t, 0, DirtyCount())
+}
+
+func TestAutosaveFailure(t *testing.T) {
+	testSetupWorld(t)
+	testResetAutosave(t)
+	setStore(failingStore{storage.NewMemory()})
+	room := NewRoom()
+	assert.NoError(t, room.markDirty())
+	other := NewRoom()
+	assert.NoError(t, other.markDirty())
+
+	// Failed saves stay queued, and only the first is reported right away.
+	assert.Equal(t, 0, FlushDirty(0))
+	assert.Equal(t, 2, DirtyCount())
+	autosave.mutex.Lock()
+	assert.False(t, autosave.lastReport.IsZero())
+	assert.Equal(t, 1, autosave.suppressed)
+	autosave.mutex.Unlock()
+}
@@ -0,0 +1,220 @@
+package construct
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// backupTimeFormat stamps player backups. It sorts in time order.
+	backupTimeFormat = "20060102-150405.000000000"
+	// snapshotDateFormat stamps the daily room snapshots.
+	snapshotDateFormat = "2006-01-02"
+	// roomSnapshotPrefix starts the key of every room snapshot.
+	roomSnapshotPrefix = "rooms."
+)
+
+// backup is an old copy of a character.
+type backup struct {
+	Key     string
+	Created time.Time
+}
+
+// backupPlayer copies a character's saved record into their backups, then
+// drops all but the newest, keeping as many as the pfile_backups config key
+// asks for. A character that hasn't been saved yet has nothing to back up.
+func backupPlayer(name string) error {
+	keep := config.GetInt("pfile_backups")
+	if keep <= 0 {
+		return nil
+	}
+	key := playerKey(name)
+	data, err := loadRecord(storage.Players, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	stamp := time.Now().UTC().Format(backupTimeFormat)
+	if err := saveRecord(storage.Backups, key+"."+stamp, data); err != nil {
+		return err
+	}
+	backups, err := playerBackups(name)
+	if err != nil {
+		return err
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+	for _, b := range backups[keep:] {
+		if err := deleteRecord(storage.Backups, b.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// playerBackups returns a character's backups, newest first.
+func playerBackups(name string) ([]*backup, error) {
+	keys, err := recordKeys(storage.Backups)
+	if err != nil {
+		return nil, err
+	}
+	prefix := playerKey(name) + "."
+	var backups []*backup
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		created, err := time.Parse(backupTimeFormat, strings.TrimPrefix(key, prefix))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, &backup{Key: key, Created: created})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Created.After(backups[j].Created)
+	})
+	return backups, nil
+}
+
+// renameBackups moves a character's backups to the key of their new name,
+// and renames the character inside each, so they can still be restored.
+func renameBackups(from, to string) error {
+	if playerKey(from) == playerKey(to) {
+		return nil
+	}
+	backups, err := playerBackups(from)
+	if err != nil {
+		return err
+	}
+	prefix := playerKey(from) + "."
+	for _, b := range backups {
+		raw, err := loadRecord(storage.Backups, b.Key)
+		if err != nil {
+			return err
+		}
+		// The backup is edited as it was saved, so that it is still
+		// migrated as its own version when it is restored.
+		doc := make(map[string]interface{})
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			log.Error().Err(err).Str("backup", b.Key).Msg("Unable to rename backup, leaving it under the old name.")
+			continue
+		}
+		doc["Name"] = to
+		if raw, err = json.Marshal(doc); err != nil {
+			return err
+		}
+		key := playerKey(to) + "." + strings.TrimPrefix(b.Key, prefix)
+		if err := saveRecord(storage.Backups, key, raw); err != nil {
+			return err
+		}
+		if err := deleteRecord(storage.Backups, b.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadBackup reads one of a character's backups.
+func loadBackup(name string, b *backup) (*playerData, error) {
+	raw, err := loadRecord(storage.Backups, b.Key)
+	if err != nil {
+		return nil, err
+	}
+	data := &playerData{}
+	if _, err := playerSchema.load(raw, data); err != nil {
+		return nil, err
+	}
+	if nameKey(data.Name) != nameKey(name) {
+		return nil, errors.New("backup belongs to " + data.Name)
+	}
+	return data, nil
+}
+
+// SnapshotRooms saves a copy of every saved room and area, once a day. Snapshots
+// beyond the number the room_snapshots config key asks for are dropped,
+// oldest first. Returns true if a snapshot was taken.
+func SnapshotRooms() (bool, error) {
+	keep := config.GetInt("room_snapshots")
+	if keep <= 0 {
+		return false, nil
+	}
+	key := roomSnapshotPrefix + time.Now().UTC().Format(snapshotDateFormat)
+	if _, err := loadRecord(storage.Backups, key); err == nil {
+		return false, nil
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return false, err
+	}
+
+	keys, err := recordKeys(storage.Rooms)
+	if err != nil {
+		return false, err
+	}
+	rooms := make(map[string]json.RawMessage, len(keys))
+	for _, k := range keys {
+		data, err := loadRecord(storage.Rooms, k)
+		if err != nil {
+			return false, err
+		}
+		rooms[k] = data
+	}
+	// Rooms in an area are saved with it, so areas are kept whole, under
+	// a key that can't be taken for a room UUID.
+	areas, err := recordKeys(storage.Areas)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range areas {
+		data, err := loadRecord(storage.Areas, id)
+		if err != nil {
+			return false, err
+		}
+		rooms["area:"+id] = data
+	}
+	data, err := json.Marshal(rooms)
+	if err != nil {
+		return false, err
+	}
+	if err := saveRecord(storage.Backups, key, data); err != nil {
+		return false, err
+	}
+	log.Info().Str("snapshot", key).Int("rooms", len(rooms)).Msg("Saved room snapshot.")
+
+	snapshots, err := roomSnapshots()
+	if err != nil {
+		return true, err
+	}
+	if len(snapshots) > keep {
+		for _, old := range snapshots[:len(snapshots)-keep] {
+			if err := deleteRecord(storage.Backups, old); err != nil {
+				return true, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// roomSnapshots returns the keys of the room snapshots, oldest first.
+func roomSnapshots() ([]string, error) {
+	keys, err := recordKeys(storage.Backups)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, roomSnapshotPrefix) {
+			snapshots = append(snapshots, key)
+		}
+	}
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
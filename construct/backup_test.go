@@ -0,0 +1,106 @@
+package construct
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/lock"
+	"github.com/Cidan/gomud/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlayerBackups(t *testing.T) {
+	testSetupWorld(t)
+	config.Set("pfile_backups", 3)
+	t.Cleanup(func() { config.Set("pfile_backups", 5) })
+
+	data := &playerData{Name: "Archive", UUID: "archive"}
+	for _, race := range []string{"Human", "Elf", "Dwarf", "Gnome", "Orc"} {
+		data.Race = race
+		assert.NoError(t, savePlayerData(data))
+	}
+	backups, err := playerBackups("archive")
+	assert.NoError(t, err)
+	if !assert.Len(t, backups, 3) {
+		return
+	}
+	// The newest backup is the save before the last one.
+	var races []string
+	for _, b := range backups {
+		backup, err := loadBackup("Archive", b)
+		assert.NoError(t, err)
+		races = append(races, backup.Race)
+	}
+	assert.Equal(t, []string{"Gnome", "Dwarf", "Elf"}, races)
+
+	_, err = loadBackup("Someone", backups[0])
+	assert.Error(t, err)
+}
+
+func TestRestoreCommand(t *testing.T) {
+	testSetupWorld(t)
+	testLoginNewUser(t, "Keeper")
+	testLoginNewUser(t, "Lost")
+	keeper := testFindPlayer(t, "Keeper")
+	lost := testFindPlayer(t, "Lost")
+	ctx := lock.Context(keeper.Context(), keeper.Data.UUID+"test")
+	keeper.setRole(ctx, roleAdmin)
+	lctx := lock.Context(lost.Context(), lost.Data.UUID+"test")
+	race := lost.GetData(lctx).Race
+	lost.Stop(lctx)
+
+	data, found, err := loadPlayerData("Lost")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	data.Race = "Mangled"
+	assert.NoError(t, savePlayerData(data))
+
+	assert.NoError(t, keeper.gameInterp.Read(ctx, "restore lost 1"))
+	data, _, err = loadPlayerData("Lost")
+	assert.NoError(t, err)
+	assert.Equal(t, race, data.Race)
+
+	// The mangled character was backed up by the restore.
+	backups, err := playerBackups("Lost")
+	assert.NoError(t, err)
+	newest, err := loadBackup("Lost", backups[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "Mangled", newest.Race)
+
+	// A deleted character is put back on their account, so they can be
+	// played again.
+	assert.NoError(t, DeleteCharacter("Lost"))
+	assert.Nil(t, testLoadAccount("Lost").Character("Lost"))
+	assert.NoError(t, keeper.gameInterp.Read(ctx, "restore lost 1"))
+	assert.True(t, characterExists("Lost"))
+	if c := testLoadAccount("Lost").Character("Lost"); assert.NotNil(t, c) {
+		assert.Equal(t, data.UUID, c.UUID)
+	}
+}
+
+func TestSnapshotRooms(t *testing.T) {
+	testSetupWorld(t)
+	config.Set("room_snapshots", 2)
+	t.Cleanup(func() { config.Set("room_snapshots", 7) })
+	room := NewRoom()
+	room.Data.Name = "Vault"
+	assert.NoError(t, room.Save())
+	assert.NoError(t, saveRecord(storage.Backups, roomSnapshotPrefix+"2000-01-01", []byte("{}")))
+	assert.NoError(t, saveRecord(storage.Backups, roomSnapshotPrefix+"2000-01-02", []byte("{}")))
+
+	taken, err := SnapshotRooms()
+	assert.NoError(t, err)
+	assert.True(t, taken)
+	taken, err = SnapshotRooms()
+	assert.NoError(t, err)
+	assert.False(t, taken)
+
+	snapshots, err := roomSnapshots()
+	assert.NoError(t, err)
+	today := roomSnapshotPrefix + time.Now().UTC().Format(snapshotDateFormat)
+	assert.Equal(t, []string{roomSnapshotPrefix + "2000-01-02", today}, snapshots)
+	data, err := loadRecord(storage.Backups, today)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "Vault")
+}
@@ -0,0 +1,268 @@
+package construct
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cidan/gomud/storage"
+)
+
+const (
+	// banSite bans an IP address or a CIDR range of addresses.
+	banSite = "site"
+	// banName bans an account or character name.
+	banName = "name"
+)
+
+// Ban keeps a site or a name out of the game, either for good or until it
+// expires.
+type Ban struct {
+	Kind    string
+	Target  string
+	Reason  string
+	By      string
+	Created time.Time
+	Expires time.Time
+}
+
+// banList is every ban in the game, saved to a single file.
+type banList struct {
+	mutex sync.RWMutex
+	bans  []*Ban
+}
+
+// bans holds every ban in the game.
+var bans = &banList{}
+
+// Permanent returns true if the ban never expires.
+func (b *Ban) Permanent() bool {
+	return b.Expires.IsZero()
+}
+
+// expired returns true if the ban has run out at the given time.
+func (b *Ban) expired(now time.Time) bool {
+	return !b.Permanent() && !now.Before(b.Expires)
+}
+
+// matches returns true if the ban covers the given target. Site bans match
+// an address, name bans match a name regardless of case.
+func (b *Ban) matches(kind, target string) bool {
+	if b.Kind != kind {
+		return false
+	}
+	if kind == banName {
+		return strings.EqualFold(b.Target, target)
+	}
+	ip := net.ParseIP(target)
+	if ip == nil {
+		return false
+	}
+	if _, network, err := net.ParseCIDR(b.Target); err == nil {
+		return network.Contains(ip)
+	}
+	return ip.Equal(net.ParseIP(b.Target))
+}
+
+// Message returns the text shown to someone kept out by the ban.
+func (b *Ban) Message() string {
+	if b.Permanent() {
+		return fmt.Sprintf("You are banned from this realm: %s", b.Reason)
+	}
+	return fmt.Sprintf("You are banned from this realm for another %s: %s", formatBanTime(time.Until(b.Expires)), b.Reason)
+}
+
+// formatBanTime formats how long a ban lasts for humans, in the largest
+// whole unit that makes sense.
+func formatBanTime(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	case d >= 2*time.Minute:
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	default:
+		return formatCountdown(d.Round(time.Second))
+	}
+}
+
+// LoadBans reads the ban list from storage. A missing ban list is not an
+// error.
+func LoadBans() error {
+	data, err := loadRecord(storage.Game, "bans")
+	if errors.Is(err, storage.ErrNotFound) {
+		data = []byte("[]")
+	} else if err != nil {
+		return err
+	}
+	var list []*Ban
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	bans.mutex.Lock()
+	defer bans.mutex.Unlock()
+	bans.bans = list
+	return nil
+}
+
+// save writes the ban list to storage. Must be called with the mutex held.
+func (l *banList) save() error {
+	data, err := json.Marshal(l.bans)
+	if err != nil {
+		return err
+	}
+	return saveRecord(storage.Game, "bans", data)
+}
+
+// prune drops every expired ban, returning true if any were dropped. Must be
+// called with the mutex held.
+func (l *banList) prune(now time.Time) bool {
+	kept := l.bans[:0]
+	for _, b := range l.bans {
+		if !b.expired(now) {
+			kept = append(kept, b)
+		}
+	}
+	pruned := len(kept) != len(l.bans)
+	l.bans = kept
+	return pruned
+}
+
+// find returns the first ban covering the target that hasn't expired, or nil
+// if there is none.
+func (l *banList) find(kind, target string) *Ban {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	now := time.Now()
+	for _, b := range l.bans {
+		if !b.expired(now) && b.matches(kind, target) {
+			return b
+		}
+	}
+	return nil
+}
+
+// add adds a ban and saves the list.
+func (l *banList) add(b *Ban) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.prune(time.Now())
+	l.bans = append(l.bans, b)
+	return l.save()
+}
+
+// remove removes a ban by its number in the list, starting at 1, or by its
+// target, and saves the list. Returns the ban removed, or nil if there was
+// no such ban.
+func (l *banList) remove(choice string) (*Ban, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.prune(time.Now())
+	index := -1
+	if n, err := strconv.Atoi(choice); err == nil {
+		if n >= 1 && n <= len(l.bans) {
+			index = n - 1
+		}
+	} else {
+		for i, b := range l.bans {
+			if strings.EqualFold(b.Target, choice) {
+				index = i
+				break
+			}
+		}
+	}
+	if index < 0 {
+		return nil, nil
+	}
+	b := l.bans[index]
+	l.bans = append(l.bans[:index], l.bans[index+1:]...)
+	return b, l.save()
+}
+
+// list returns every ban that hasn't expired, saving the list if any have.
+func (l *banList) list() ([]*Ban, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var err error
+	if l.prune(time.Now()) {
+		err = l.save()
+	}
+	list := make([]*Ban, len(l.bans))
+	copy(list, l.bans)
+	return list, err
+}
+
+// SiteBan returns the ban covering an address, or nil if it isn't banned.
+func SiteBan(address string) *Ban {
+	return bans.find(banSite, address)
+}
+
+// nameBan returns the ban covering an account or character name, or nil if
+// it isn't banned.
+func nameBan(name string) *Ban {
+	return bans.find(banName, name)
+}
+
+// covers returns true if the ban covers a player in the world, by their
+// address, character name or account name.
+func (b *Ban) covers(ctx context.Context, p *Player) bool {
+	if b.Kind == banSite {
+		return b.matches(banSite, p.GetAddress(ctx))
+	}
+	if b.matches(banName, p.GetName(ctx)) {
+		return true
+	}
+	account := p.GetAccount(ctx)
+	return account != nil && b.matches(banName, account.GetName())
+}
+
+// validBanTarget returns an error if the target can't be banned as the given
+// kind.
+func validBanTarget(kind, target string) error {
+	switch kind {
+	case banSite:
+		if _, _, err := net.ParseCIDR(target); err == nil {
+			return nil
+		}
+		if net.ParseIP(target) == nil {
+			return fmt.Errorf("%s is not an IP address or CIDR range", target)
+		}
+	case banName:
+		if validNameFormat(target) != nil {
+			return fmt.Errorf("%s is not a valid name", target)
+		}
+	default:
+		return fmt.Errorf("unknown ban type %s", kind)
+	}
+	return nil
+}
+
+// parseBanDuration parses how long a ban lasts. On top of the usual Go
+// durations, days and weeks may be given as "7d" or "2w".
+func parseBanDuration(text string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if strings.HasSuffix(text, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(text, suffix))
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid duration %s", text)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %s", text)
+	}
+	return d, nil
+}
@@ -0,0 +1,140 @@
+package construct
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cidan/gomud/lock"
+	"github.com/stretchr/testify/assert"
+)
+
+// testResetBans empties the ban list now and once the test is done.
+func testResetBans(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		bans.mutex.Lock()
+		defer bans.mutex.Unlock()
+		bans.bans = nil
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestBanMatches(t *testing.T) {
+	testSetupWorld(t)
+	testResetBans(t)
+	now := time.Now()
+	assert.NoError(t, bans.add(&Ban{Kind: banSite, Target: "10.1.0.0/16", Reason: "spam", Created: now}))
+	assert.NoError(t, bans.add(&Ban{Kind: banSite, Target: "2001:db8::1", Reason: "spam", Created: now}))
+	assert.NoError(t, bans.add(&Ban{Kind: banName, Target: "Exile", Reason: "rude", Created: now, Expires: now.Add(time.Hour)}))
+
+	assert.NotNil(t, SiteBan("10.1.200.3"))
+	assert.Nil(t, SiteBan("10.2.0.1"))
+	assert.NotNil(t, SiteBan("2001:0db8:0:0:0:0:0:1"))
+	assert.Nil(t, SiteBan("pipe"))
+	assert.NotNil(t, nameBan("exile"))
+	assert.Nil(t, nameBan("Exiled"))
+
+	// Bans are kept on disk, and expired bans are forgotten.
+	bans.mutex.Lock()
+	bans.bans[2].Expires = now.Add(-time.Second)
+	bans.mutex.Unlock()
+	assert.Nil(t, nameBan("Exile"))
+	list, err := bans.list()
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	assert.NoError(t, LoadBans())
+	assert.NotNil(t, SiteBan("10.1.0.1"))
+	b, err := bans.remove("10.1.0.0/16")
+	assert.NoError(t, err)
+	assert.NotNil(t, b)
+	b, err = bans.remove("5")
+	assert.NoError(t, err)
+	assert.Nil(t, b)
+
+	assert.NoError(t, LoadBans())
+	assert.Nil(t, SiteBan("10.1.0.1"))
+	assert.NotNil(t, SiteBan("2001:db8::1"))
+}
+
+func TestParseBanDuration(t *testing.T) {
+	for text, want := range map[string]time.Duration{
+		"90m": 90 * time.Minute,
+		"7d":  7 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+	} {
+		d, err := parseBanDuration(text)
+		assert.NoError(t, err)
+		assert.Equal(t, want, d)
+	}
+	for _, text := range []string{"spam", "0d", "-1h", "d"} {
+		_, err := parseBanDuration(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestNameBanRefusesLogin(t *testing.T) {
+	testSetupWorld(t)
+	testResetBans(t)
+	assert.NoError(t, bans.add(&Ban{Kind: banName, Target: "Outcast", Reason: "cheating", Created: time.Now()}))
+
+	client, server := net.Pipe()
+	p := NewPlayer()
+	ctx := lock.Context(p.Context(), p.Data.UUID+"incomming_conn")
+	p.SetConnection(ctx, server)
+	go p.Start()
+
+	output := make(chan string)
+	go func() {
+		var all strings.Builder
+		reader := bufio.NewReader(client)
+		for {
+			text, err := reader.ReadString('\xf9')
+			all.WriteString(text)
+			if err != nil {
+				output <- all.String()
+				return
+			}
+		}
+	}()
+	w := bufio.NewWriter(client)
+	runCommands(t, nil, w, []string{"outcast"})
+
+	select {
+	case text := <-output:
+		assert.Contains(t, text, "You are banned from this realm: cheating")
+	case <-time.After(5 * time.Second):
+		t.Fatal("banned player was not disconnected")
+	}
+}
+
+func TestBanCommandDisconnects(t *testing.T) {
+	testSetupWorld(t)
+	testResetBans(t)
+	testLoginNewUser(t, "Warden")
+	testLoginNewUser(t, "Rowdy")
+	warden := testFindPlayer(t, "Warden")
+	rowdy := testFindPlayer(t, "Rowdy")
+	ctx := lock.Context(warden.Context(), warden.Data.UUID+"test")
+	warden.setRole(ctx, roleAdmin)
+
+	assert.NoError(t, warden.Command("ban name Rowdy 1d starting fights"))
+	assert.Eventually(t, func() bool {
+		return rowdy.Context().Err() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	b := nameBan("rowdy")
+	if assert.NotNil(t, b) {
+		assert.Equal(t, "starting fights", b.Reason)
+		assert.Equal(t, "Warden", b.By)
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), b.Expires, time.Minute)
+	}
+
+	assert.NoError(t, warden.Command("unban rowdy"))
+	assert.Eventually(t, func() bool {
+		return nameBan("rowdy") == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
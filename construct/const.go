@@ -1,7 +1,5 @@
 package construct
 
-import "time"
-
 type direction int
 
 const (
@@ -32,5 +30,3 @@ var dirNames = map[direction]string{
 	dirUp:    "up",
 	dirDown:  "down",
 }
-
-const maxIdleTime = time.Minute * 15
@@ -0,0 +1,186 @@
+package construct
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/lock"
+	"github.com/Cidan/gomud/telnet"
+	"github.com/rs/zerolog/log"
+)
+
+// copyoverEnv is the environment variable that tells a freshly executed
+// server where to find the state left behind by a reboot.
+const copyoverEnv = "GOMUD_COPYOVER"
+
+var errCopyoverUnsupported = errors.New("reboot is not supported on this platform")
+
+// copyoverState is everything carried across a reboot.
+type copyoverState struct {
+	Players []*copyoverPlayer
+}
+
+// copyoverPlayer is the state of a single connected player carried across a
+// reboot. FD is the socket file descriptor inherited by the new process.
+type copyoverPlayer struct {
+	Name   string
+	Interp string
+	Room   string
+	FD     uintptr
+	Telnet telnet.State
+}
+
+// fileConn is implemented by connections that can hand their socket over to
+// another process, such as *net.TCPConn.
+type fileConn interface {
+	File() (*os.File, error)
+}
+
+// Copyover saves the world and re-executes the server binary, handing every
+// player's connection to the new process so that they stay connected. It
+// only returns if the reboot failed. Players on connections that can't be
+// handed over, such as TLS or WebSocket connections, are saved and asked to
+// reconnect.
+func (a *AtlasData) Copyover() error {
+	if !atomic.CompareAndSwapInt32(&a.shuttingDown, 0, 1) {
+		return errors.New("the realm is already shutting down")
+	}
+	log.Info().Msg("Rebooting.")
+	a.Broadcast("{RThe realm is rebooting, please hold on.{x")
+
+	state := &copyoverState{}
+	var files []*os.File
+	var players []*Player
+	a.AllPlayers(func(p *Player) {
+		ctx := lock.Context(p.Context(), p.GetUUID(p.Context())+"copyover")
+		if err := p.Save(ctx); err != nil {
+			log.Error().Err(err).Str("player", p.GetName(ctx)).Msg("Unable to save player on reboot.")
+		}
+		f, tstate, err := p.handOver(ctx)
+		if err != nil {
+			log.Info().Err(err).Str("player", p.GetName(ctx)).Msg("Player connection can't be kept across reboot.")
+			p.Write(ctx, "{RYour connection can't be kept across the reboot, please reconnect in a moment.{x")
+			return
+		}
+		files = append(files, f)
+		players = append(players, p)
+		state.Players = append(state.Players, &copyoverPlayer{
+			Name:   p.GetName(ctx),
+			Interp: p.interpName(ctx),
+			Room:   p.GetData(ctx).Room,
+			FD:     f.Fd(),
+			Telnet: tstate,
+		})
+	})
+	a.saveRooms()
+
+	path := filepath.Join(config.GetString("save_path"), "copyover.json")
+	err := writeCopyover(path, state)
+	if err == nil {
+		// The new process opens storage itself. Should the reboot fail,
+		// storage is opened again the next time it is used.
+		if err := CloseStorage(); err != nil {
+			log.Error().Err(err).Msg("Unable to close storage for reboot.")
+		}
+		// This only returns on failure.
+		err = execSelf(path)
+		os.Remove(path)
+	}
+
+	// The reboot failed, put everyone back the way they were.
+	log.Error().Err(err).Msg("Reboot failed.")
+	for _, f := range files {
+		f.Close()
+	}
+	for _, p := range players {
+		p.applyCompression(lock.Context(p.Context(), p.GetUUID(p.Context())+"copyover"))
+	}
+	atomic.StoreInt32(&a.shuttingDown, 0)
+	a.Broadcast("{RThe reboot failed, carry on.{x")
+	return err
+}
+
+// handOver prepares the player's connection to be inherited by a new
+// process, returning a copy of the socket and the negotiated telnet state.
+// Compression is turned off first so that the new process starts from an
+// uncompressed stream.
+func (p *Player) handOver(ctx context.Context) (*os.File, telnet.State, error) {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	conn := p.connection
+	if conn == nil {
+		return nil, telnet.State{}, errors.New("player has no connection")
+	}
+	raw, ok := conn.Conn.(fileConn)
+	if !ok {
+		return nil, telnet.State{}, fmt.Errorf("%T can't be handed over", conn.Conn)
+	}
+	if err := conn.SetCompression(false); err != nil {
+		return nil, telnet.State{}, err
+	}
+	f, err := raw.File()
+	if err != nil {
+		return nil, telnet.State{}, err
+	}
+	if err := inheritable(f); err != nil {
+		f.Close()
+		return nil, telnet.State{}, err
+	}
+	return f, conn.State(), nil
+}
+
+// writeCopyover writes the reboot state to the given path.
+func writeCopyover(path string, state *copyoverState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// RestoreCopyover reattaches the players left behind by a reboot, if this
+// process was started by one. It must be called once the world is loaded.
+func RestoreCopyover() error {
+	path := os.Getenv(copyoverEnv)
+	if path == "" {
+		return nil
+	}
+	os.Unsetenv(copyoverEnv)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	os.Remove(path)
+
+	var state copyoverState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	for _, cp := range state.Players {
+		f := os.NewFile(cp.FD, cp.Name)
+		c, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			log.Error().Err(err).Str("player", cp.Name).Msg("Unable to restore player connection after reboot.")
+			continue
+		}
+		p := NewPlayer()
+		ctx := lock.Context(p.Context(), p.GetUUID(p.Context())+"copyover")
+		p.SetConnection(ctx, c)
+		log.Info().
+			Str("player", cp.Name).
+			Str("address", c.RemoteAddr().String()).
+			Msg("Restored connection after reboot.")
+		go p.Resume(cp)
+	}
+	log.Info().Int("players", len(state.Players)).Msg("Reboot complete.")
+	return nil
+}
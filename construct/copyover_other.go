@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package construct
+
+import "os"
+
+func inheritable(f *os.File) error {
+	return errCopyoverUnsupported
+}
+
+func execSelf(path string) error {
+	return errCopyoverUnsupported
+}
@@ -0,0 +1,55 @@
+package construct
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Cidan/gomud/lock"
+	"github.com/Cidan/gomud/telnet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResumeAfterCopyover(t *testing.T) {
+	testSetupWorld(t)
+	old := NewPlayer()
+	octx := lock.Context(old.Context(), old.Data.UUID+"test")
+	old.SetName(octx, "Resumed")
+	assert.NoError(t, old.Save(octx))
+
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+	})
+	go func() {
+		r := bufio.NewReader(client)
+		for {
+			if _, err := r.ReadString('\xf9'); err != nil {
+				return
+			}
+		}
+	}()
+
+	p := NewPlayer()
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+	p.SetConnection(ctx, server)
+	go p.Resume(&copyoverPlayer{
+		Name:   "Resumed",
+		Interp: "text",
+		Room:   Atlas.GetRoom(0, 0, 0).Data.UUID,
+		Telnet: telnet.State{SGA: true, Echo: true, Width: 100, Height: 40},
+	})
+
+	assert.Eventually(t, func() bool {
+		return p.GetRoom(ctx) != nil
+	}, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, Atlas.GetRoom(0, 0, 0), p.GetRoom(ctx))
+	assert.Eventually(t, func() bool {
+		return p.interpName(ctx) == "build"
+	}, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, 100, p.TelnetState(ctx).Width)
+	assert.True(t, p.TelnetState(ctx).SGA)
+
+	p.Stop(ctx)
+}
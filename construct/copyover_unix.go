@@ -0,0 +1,29 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package construct
+
+import (
+	"os"
+	"syscall"
+)
+
+// inheritable clears close-on-exec on a file so that it is inherited by the
+// next process.
+func inheritable(f *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), syscall.F_SETFD, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// execSelf replaces the running process with a fresh copy of the server
+// binary, pointing it at the reboot state in path.
+func execSelf(path string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	env := append(os.Environ(), copyoverEnv+"="+path)
+	return syscall.Exec(exe, os.Args, env)
+}
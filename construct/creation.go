@@ -0,0 +1,294 @@
+package construct
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Cidan/gomud/config"
+)
+
+const (
+	// attributeBase is where every attribute starts when buying with points.
+	attributeBase = 8
+	// attributeMax is the highest an attribute may be bought or rolled to,
+	// before racial modifiers.
+	attributeMax = 18
+	// attributePoints is how many points there are to spend when buying
+	// attributes.
+	attributePoints = 20
+)
+
+// attributeNames are the attributes every character has, in display order.
+var attributeNames = []string{"str", "int", "wis", "dex", "con"}
+
+// playerAttributes are a character's attributes, set at creation.
+type playerAttributes struct {
+	Str int64
+	Int int64
+	Wis int64
+	Dex int64
+	Con int64
+}
+
+// get returns an attribute by its short name.
+func (a *playerAttributes) get(name string) int64 {
+	return *a.field(name)
+}
+
+// set sets an attribute by its short name.
+func (a *playerAttributes) set(name string, value int64) {
+	*a.field(name) = value
+}
+
+func (a *playerAttributes) field(name string) *int64 {
+	switch name {
+	case "str":
+		return &a.Str
+	case "int":
+		return &a.Int
+	case "wis":
+		return &a.Wis
+	case "dex":
+		return &a.Dex
+	case "con":
+		return &a.Con
+	}
+	panic(fmt.Sprintf("unknown attribute %s", name))
+}
+
+// String formats the attributes for display.
+func (a *playerAttributes) String() string {
+	var parts []string
+	for _, name := range attributeNames {
+		parts = append(parts, fmt.Sprintf("%s %d", strings.ToUpper(name), a.get(name)))
+	}
+	return strings.Join(parts, "  ")
+}
+
+// race is a playable race. Attributes are added to the character's own, and
+// Start is the room new characters of the race begin in.
+type race struct {
+	Name        string
+	Description string
+	Attributes  map[string]int64
+	Start       *[3]int64
+}
+
+// class is a playable class. The base stats are added to what the
+// character's attributes give them.
+type class struct {
+	Name        string
+	Description string
+	Health      int64
+	Mana        int64
+	Move        int64
+}
+
+// creationTables are the races and classes to choose from when creating a
+// character.
+type creationTables struct {
+	Races   []*race
+	Classes []*class
+}
+
+// defaultCreationTables are used unless the creation_file config key names a
+// JSON file of races and classes to use instead.
+var defaultCreationTables = &creationTables{
+	Races: []*race{
+		{
+			Name:        "Human",
+			Description: "Adaptable and ambitious, humans are found everywhere.",
+			Attributes:  map[string]int64{},
+		},
+		{
+			Name:        "Elf",
+			Description: "Graceful and long lived, elves are quick of hand and mind.",
+			Attributes:  map[string]int64{"dex": 1, "int": 1, "con": -2},
+		},
+		{
+			Name:        "Dwarf",
+			Description: "Stout and stubborn, dwarves endure what others can't.",
+			Attributes:  map[string]int64{"con": 2, "str": 1, "dex": -2},
+		},
+	},
+	Classes: []*class{
+		{
+			Name:        "Warrior",
+			Description: "Masters of arms and armor.",
+			Health:      60,
+			Mana:        10,
+			Move:        50,
+		},
+		{
+			Name:        "Mage",
+			Description: "Students of the arcane.",
+			Health:      25,
+			Mana:        60,
+			Move:        35,
+		},
+		{
+			Name:        "Thief",
+			Description: "Quick, quiet and never where you expect.",
+			Health:      40,
+			Mana:        25,
+			Move:        60,
+		},
+	},
+}
+
+var creation = struct {
+	mutex  sync.RWMutex
+	tables *creationTables
+}{tables: defaultCreationTables}
+
+// LoadCreationTables reads the races and classes from the file named by the
+// creation_file config key, or uses the built in ones if it isn't set.
+func LoadCreationTables() error {
+	tables := defaultCreationTables
+	if path := config.GetString("creation_file"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		tables = &creationTables{}
+		if err := json.Unmarshal(data, tables); err != nil {
+			return err
+		}
+		if err := tables.validate(); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	creation.mutex.Lock()
+	defer creation.mutex.Unlock()
+	creation.tables = tables
+	return nil
+}
+
+// validate makes sure there is something to choose from, and that races only
+// modify attributes that exist.
+func (t *creationTables) validate() error {
+	if len(t.Races) == 0 || len(t.Classes) == 0 {
+		return fmt.Errorf("at least one race and one class are needed")
+	}
+	for _, r := range t.Races {
+		for name := range r.Attributes {
+			if !isAttribute(name) {
+				return fmt.Errorf("race %s modifies unknown attribute %s", r.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// getCreationTables returns the races and classes currently in use.
+func getCreationTables() *creationTables {
+	creation.mutex.RLock()
+	defer creation.mutex.RUnlock()
+	return creation.tables
+}
+
+// isAttribute returns true if name is the short name of an attribute.
+func isAttribute(name string) bool {
+	for _, a := range attributeNames {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+// findRace finds a race by name or by its number in the list, starting at 1.
+func findRace(choice string) *race {
+	races := getCreationTables().Races
+	if n, err := strconv.Atoi(choice); err == nil {
+		if n < 1 || n > len(races) {
+			return nil
+		}
+		return races[n-1]
+	}
+	for _, r := range races {
+		if strings.EqualFold(r.Name, choice) {
+			return r
+		}
+	}
+	return nil
+}
+
+// findClass finds a class by name or by its number in the list, starting
+// at 1.
+func findClass(choice string) *class {
+	classes := getCreationTables().Classes
+	if n, err := strconv.Atoi(choice); err == nil {
+		if n < 1 || n > len(classes) {
+			return nil
+		}
+		return classes[n-1]
+	}
+	for _, c := range classes {
+		if strings.EqualFold(c.Name, choice) {
+			return c
+		}
+	}
+	return nil
+}
+
+// rollAttributes rolls every attribute as the best three of four six sided
+// dice.
+func rollAttributes() *playerAttributes {
+	a := &playerAttributes{}
+	for _, name := range attributeNames {
+		dice := []int{rand.Intn(6) + 1, rand.Intn(6) + 1, rand.Intn(6) + 1, rand.Intn(6) + 1}
+		sort.Ints(dice)
+		a.set(name, int64(dice[1]+dice[2]+dice[3]))
+	}
+	return a
+}
+
+// baseAttributes returns attributes at their point buy starting value.
+func baseAttributes() *playerAttributes {
+	a := &playerAttributes{}
+	for _, name := range attributeNames {
+		a.set(name, attributeBase)
+	}
+	return a
+}
+
+// pointsSpent returns how many points have been spent buying attributes.
+func (a *playerAttributes) pointsSpent() int64 {
+	var spent int64
+	for _, name := range attributeNames {
+		spent += a.get(name) - attributeBase
+	}
+	return spent
+}
+
+// withRace returns a copy of the attributes with the race's modifiers added.
+func (a *playerAttributes) withRace(r *race) *playerAttributes {
+	final := *a
+	for name, mod := range r.Attributes {
+		final.set(name, final.get(name)+mod)
+	}
+	return &final
+}
+
+// startingStats returns the stats a new character begins with, from their
+// class and final attributes.
+func startingStats(c *class, a *playerAttributes) *playerStats {
+	health := c.Health + a.Con*4
+	mana := c.Mana + (a.Int+a.Wis)*2
+	move := c.Move + a.Dex*4
+	return &playerStats{
+		Health:    health,
+		Mana:      mana,
+		Move:      move,
+		MaxHealth: health,
+		MaxMana:   mana,
+		MaxMove:   move,
+	}
+}
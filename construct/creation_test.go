@@ -0,0 +1,68 @@
+package construct
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreationPointBuy(t *testing.T) {
+	testSetupWorld(t)
+	_, w := testConnect(t)
+	runCommands(t, nil, w, []string{
+		"Builder", "yes", testPassword, testPassword, "Builder", "yes",
+		// Change our mind about being an elf.
+		"elf", "back", "3", "warrior", "buy",
+		"str 18", "con 19", "con 18", "done", "yes",
+	})
+	testFindPlayer(t, "Builder")
+
+	data, found, err := loadPlayerData("Builder")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "Dwarf", data.Race)
+	assert.Equal(t, "Warrior", data.Class)
+	assert.Equal(t, &playerAttributes{Str: 19, Int: 8, Wis: 8, Dex: 6, Con: 20}, data.Attributes)
+	assert.Equal(t, int64(60+20*4), data.Stats.MaxHealth)
+	assert.Equal(t, int64(10+16*2), data.Stats.MaxMana)
+	assert.Equal(t, int64(50+6*4), data.Stats.Move)
+}
+
+func TestRollAttributes(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		a := rollAttributes()
+		for _, name := range attributeNames {
+			assert.GreaterOrEqual(t, a.get(name), int64(3))
+			assert.LessOrEqual(t, a.get(name), int64(attributeMax))
+		}
+	}
+}
+
+func TestLoadCreationTables(t *testing.T) {
+	t.Cleanup(func() {
+		config.Set("creation_file", "")
+		LoadCreationTables()
+	})
+	path := filepath.Join(t.TempDir(), "creation.json")
+	config.Set("creation_file", path)
+
+	os.WriteFile(path, []byte(`{"Races": [{"Name": "Gnome", "Attributes": {"int": 2}, "Start": [1, 2, 3]}], "Classes": [{"Name": "Tinker", "Health": 10}]}`), 0644)
+	assert.NoError(t, LoadCreationTables())
+	gnome := findRace("1")
+	if assert.NotNil(t, gnome) {
+		assert.Equal(t, "Gnome", gnome.Name)
+		assert.Equal(t, &[3]int64{1, 2, 3}, gnome.Start)
+	}
+	assert.Nil(t, findRace("human"))
+	assert.NotNil(t, findClass("tinker"))
+
+	os.WriteFile(path, []byte(`{"Races": [{"Name": "Gnome", "Attributes": {"luck": 2}}], "Classes": [{"Name": "Tinker"}]}`), 0644)
+	assert.Error(t, LoadCreationTables())
+	os.WriteFile(path, []byte(`{"Races": [], "Classes": [{"Name": "Tinker"}]}`), 0644)
+	assert.Error(t, LoadCreationTables())
+	// A bad file leaves the tables as they were.
+	assert.Equal(t, "Gnome", findRace("1").Name)
+}
@@ -0,0 +1,247 @@
+package construct
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Cidan/gomud/lock"
+	"github.com/Cidan/gomud/telnet"
+	"github.com/rs/zerolog/log"
+)
+
+// GMCPHandler is the callback signature for handling an inbound GMCP message
+// from a client. message is the full message name, i.e. "Core.Hello", and
+// data is the raw JSON payload, which may be empty.
+type GMCPHandler func(ctx context.Context, p *Player, message string, data []byte) error
+
+// gmcpRegistry holds all known GMCP packages, keyed by lower case package
+// name.
+type gmcpRegistry struct {
+	packages map[string]GMCPHandler
+	mutex    sync.RWMutex
+}
+
+var gmcpPackages = &gmcpRegistry{
+	packages: make(map[string]GMCPHandler),
+}
+
+func init() {
+	RegisterGMCP("Core", handleGMCPCore)
+	RegisterGMCP("Char", nil)
+	RegisterGMCP("Room", nil)
+}
+
+// RegisterGMCP registers a GMCP package, i.e. "Char" or "Char.Items". The
+// handler is called for inbound messages in the package and may be nil if
+// the package is only ever sent to clients. Inbound messages are routed to
+// the most specific registered package.
+func RegisterGMCP(name string, fn GMCPHandler) {
+	gmcpPackages.mutex.Lock()
+	defer gmcpPackages.mutex.Unlock()
+	gmcpPackages.packages[strings.ToLower(name)] = fn
+}
+
+// lookup finds the handler for a message, walking up the package path until
+// a registered package is found.
+func (g *gmcpRegistry) lookup(message string) (GMCPHandler, bool) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	name := strings.ToLower(message)
+	for {
+		if fn, ok := g.packages[name]; ok {
+			return fn, true
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			return nil, false
+		}
+		name = name[:i]
+	}
+}
+
+// gmcpVitals is the payload for Char.Vitals.
+type gmcpVitals struct {
+	Health    int64 `json:"hp"`
+	MaxHealth int64 `json:"maxhp"`
+	Mana      int64 `json:"mp"`
+	MaxMana   int64 `json:"maxmp"`
+	Move      int64 `json:"mv"`
+	MaxMove   int64 `json:"maxmv"`
+}
+
+// gmcpRoomInfo is the payload for Room.Info.
+type gmcpRoomInfo struct {
+	UUID  string            `json:"num"`
+	Name  string            `json:"name"`
+	X     int64             `json:"x"`
+	Y     int64             `json:"y"`
+	Z     int64             `json:"z"`
+	Exits map[string]string `json:"exits"`
+}
+
+// gmcpStatus is the payload for Char.Status.
+type gmcpStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// handleGMCP is the subnegotiation callback for GMCP on a player connection.
+func (p *Player) handleGMCP(data []byte) {
+	ctx := lock.Context(p.ctx, p.Data.UUID+"gmcp")
+	message, payload := telnet.ParseGMCP(data)
+	fn, ok := gmcpPackages.lookup(message)
+	if !ok || fn == nil {
+		log.Debug().Str("player", p.Data.UUID).Str("message", message).Msg("unhandled gmcp message")
+		return
+	}
+	if err := fn(ctx, p, message, payload); err != nil {
+		log.Error().Err(err).
+			Str("player", p.Data.UUID).
+			Str("message", message).
+			Msg("Error handling GMCP message from player.")
+	}
+}
+
+// handleGMCPCore handles the Core package, which clients use to announce
+// themselves and the packages they support.
+func handleGMCPCore(ctx context.Context, p *Player, message string, data []byte) error {
+	switch strings.ToLower(message) {
+	case "core.hello":
+		var hello map[string]string
+		if err := json.Unmarshal(data, &hello); err != nil {
+			return err
+		}
+		log.Debug().Str("player", p.GetUUID(ctx)).Interface("client", hello).Msg("gmcp hello")
+	case "core.supports.set", "core.supports.add", "core.supports.remove":
+		var list []string
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		p.setGMCPSupports(ctx, strings.ToLower(message), list)
+		// Bring the client up to date with everything it now understands.
+		if p.IsInGame(ctx) {
+			p.sendGMCPVitals(ctx)
+			p.sendGMCPStatus(ctx)
+			if room := p.GetRoom(ctx); room != nil {
+				p.sendGMCPRoom(ctx, room)
+			}
+		}
+	case "core.ping":
+		return p.SendGMCP(ctx, "Core.Ping", nil)
+	}
+	return nil
+}
+
+// setGMCPSupports updates the list of packages the client supports, given
+// a list of "Package version" strings.
+func (p *Player) setGMCPSupports(ctx context.Context, op string, list []string) {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	if op == "core.supports.set" || p.gmcpSupports == nil {
+		p.gmcpSupports = make(map[string]int)
+	}
+	for _, entry := range list {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToLower(fields[0])
+		if op == "core.supports.remove" {
+			delete(p.gmcpSupports, name)
+			continue
+		}
+		version := 1
+		if len(fields) > 1 {
+			if v, err := strconv.Atoi(fields[1]); err == nil {
+				version = v
+			}
+		}
+		p.gmcpSupports[name] = version
+	}
+}
+
+// GMCPSupports returns true if the player's client has said it supports
+// the package the given message belongs to.
+func (p *Player) GMCPSupports(ctx context.Context, message string) bool {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	name := strings.ToLower(message)
+	if strings.HasPrefix(name, "core.") {
+		return true
+	}
+	for {
+		if _, ok := p.gmcpSupports[name]; ok {
+			return true
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			return false
+		}
+		name = name[:i]
+	}
+}
+
+// SendGMCP sends a GMCP message to the player if their client negotiated
+// GMCP and supports the message package. data is encoded as JSON, a nil
+// data sends the message without a payload.
+func (p *Player) SendGMCP(ctx context.Context, message string, data interface{}) error {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	conn := p.connection
+	if conn == nil || !conn.LocalEnabled(telnet.OptGMCP) || !p.GMCPSupports(ctx, message) {
+		return nil
+	}
+
+	var payload []byte
+	if data != nil {
+		var err error
+		if payload, err = json.Marshal(data); err != nil {
+			return err
+		}
+	}
+	return conn.SendGMCP(message, payload)
+}
+
+// sendGMCPVitals sends Char.Vitals with the player's current stats.
+func (p *Player) sendGMCPVitals(ctx context.Context) {
+	stats := p.GetData(ctx).Stats
+	p.SendGMCP(ctx, "Char.Vitals", &gmcpVitals{
+		Health:    stats.Health,
+		MaxHealth: stats.MaxHealth,
+		Mana:      stats.Mana,
+		MaxMana:   stats.MaxMana,
+		Move:      stats.Move,
+		MaxMove:   stats.MaxMove,
+	})
+}
+
+// sendGMCPRoom sends Room.Info for the given room.
+func (p *Player) sendGMCPRoom(ctx context.Context, room *Room) {
+	info := &gmcpRoomInfo{
+		UUID:  room.Data.UUID,
+		Name:  room.GetName(),
+		X:     room.Data.X,
+		Y:     room.Data.Y,
+		Z:     room.Data.Z,
+		Exits: make(map[string]string),
+	}
+	for _, dir := range exitDirections {
+		exit := room.Exit(ctx, dir)
+		if exit.Target == "" || exit.Wall {
+			continue
+		}
+		info.Exits[Atlas.dirToName(dir)] = exit.Target
+	}
+	p.SendGMCP(ctx, "Room.Info", info)
+}
+
+// sendGMCPStatus sends Char.Status with the player's current interp mode.
+func (p *Player) sendGMCPStatus(ctx context.Context) {
+	p.SendGMCP(ctx, "Char.Status", &gmcpStatus{
+		Name:  p.GetName(ctx),
+		State: p.interpName(ctx),
+	})
+}
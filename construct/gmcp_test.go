@@ -0,0 +1,44 @@
+package construct
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Cidan/gomud/lock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGMCPLookup(t *testing.T) {
+	called := ""
+	RegisterGMCP("Test.Items", func(ctx context.Context, p *Player, message string, data []byte) error {
+		called = message
+		return nil
+	})
+
+	fn, ok := gmcpPackages.lookup("test.items.list")
+	assert.True(t, ok)
+	assert.NoError(t, fn(context.Background(), nil, "Test.Items.List", nil))
+	assert.Equal(t, "Test.Items.List", called)
+
+	_, ok = gmcpPackages.lookup("Test.Other")
+	assert.False(t, ok)
+
+	fn, ok = gmcpPackages.lookup("Char.Vitals")
+	assert.True(t, ok)
+	assert.Nil(t, fn)
+}
+
+func TestGMCPSupports(t *testing.T) {
+	p := NewPlayer()
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+
+	p.setGMCPSupports(ctx, "core.supports.set", []string{"Char 1", "Room.Info 1"})
+	assert.True(t, p.GMCPSupports(ctx, "Char.Vitals"))
+	assert.True(t, p.GMCPSupports(ctx, "Room.Info"))
+	assert.False(t, p.GMCPSupports(ctx, "Room.Players"))
+	assert.True(t, p.GMCPSupports(ctx, "Core.Ping"))
+
+	p.setGMCPSupports(ctx, "core.supports.remove", []string{"Char"})
+	assert.False(t, p.GMCPSupports(ctx, "Char.Vitals"))
+	assert.True(t, p.GMCPSupports(ctx, "Room.Info"))
+}
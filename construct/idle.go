@@ -0,0 +1,154 @@
+package construct
+
+import (
+	"context"
+	"time"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Idle stages a player moves through as they sit idle.
+const (
+	idleActive = iota
+	idleWarned
+	idleVoided
+)
+
+// Void returns the limbo room idle players are moved to. The void is not
+// part of the world map and is never saved.
+func (a *AtlasData) Void() *Room {
+	a.voidOnce.Do(func() {
+		a.void = NewRoom()
+		a.void.void = true
+		a.void.SetName("The Void")
+		a.void.SetDescription("You float in a formless void, detached from the realm. Do something to return.")
+	})
+	return a.void
+}
+
+// idleLimits returns how long the player may be idle before being warned,
+// moved to the void and disconnected. Players editing text get a longer
+// grace so they don't lose their buffer.
+func (p *Player) idleLimits(ctx context.Context) (warn, void, disconnect time.Duration) {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	var grace time.Duration
+	if p.currentInterp == p.textInterp {
+		grace = config.GetDuration("idle_editor_grace")
+	}
+	return config.GetDuration("idle_warn") + grace,
+		config.GetDuration("idle_void") + grace,
+		config.GetDuration("idle_disconnect") + grace
+}
+
+// checkIdle warns, voids and finally disconnects a player as they sit
+// idle. It is called from the player tick.
+func (p *Player) checkIdle(ctx context.Context) {
+	warn, void, disconnect := p.idleLimits(ctx)
+	p.lock.Lock(ctx)
+	idle := time.Since(p.lastActionTime)
+	stage := p.idleStage
+	linkdead := p.linkdead
+	p.lock.Unlock(ctx)
+
+	// Link dead players have their own timeout.
+	if linkdead {
+		return
+	}
+
+	// Connections that never made it into the world are simply dropped.
+	if p.interpName(ctx) == "login" {
+		if idle >= disconnect {
+			log.Info().Str("player", p.GetUUID(ctx)).Msg("Idle login timed out.")
+			p.Write(ctx, "You took too long to log in, goodbye.")
+			p.cancel()
+		}
+		return
+	}
+
+	switch {
+	case idle >= disconnect:
+		p.idleDisconnect(ctx)
+	case idle >= void && stage < idleVoided:
+		p.toVoid(ctx)
+	case idle >= warn && stage < idleWarned:
+		p.setIdleStage(ctx, idleWarned)
+		p.Write(ctx, "{YYou have been idle for a while, you will be moved to the void soon.{x")
+	}
+}
+
+// setIdleStage sets the player's idle stage.
+func (p *Player) setIdleStage(ctx context.Context, stage int) {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	p.idleStage = stage
+}
+
+// toVoid moves an idle player out of the world and into the void, then saves
+// them. The player's real room is kept so that they are saved there and can
+// be returned to it.
+func (p *Player) toVoid(ctx context.Context) {
+	room := p.GetRoom(ctx)
+	if room == nil {
+		return
+	}
+	log.Info().Str("player", p.GetName(ctx)).Msg("Moving idle player to the void.")
+	p.Write(ctx, "You fade out of the realm and into the void.")
+	room.AllPlayers(ctx, func(uuid string, rp *Player) {
+		if rp == p {
+			return
+		}
+		rp.Write(ctx, "%s fades into the void.", p.GetName(ctx))
+	})
+
+	p.lock.Lock(ctx)
+	p.voidFrom = room
+	p.idleStage = idleVoided
+	p.lock.Unlock(ctx)
+	p.ToRoom(ctx, Atlas.Void())
+	if err := p.Save(ctx); err != nil {
+		log.Error().Err(err).Str("player", p.GetName(ctx)).Msg("Unable to save idle player.")
+	}
+}
+
+// wake marks the player as active, bringing them back from the void if
+// they were idle long enough to be moved there.
+func (p *Player) wake(ctx context.Context) {
+	p.lock.Lock(ctx)
+	p.lastActionTime = time.Now()
+	from := p.voidFrom
+	p.voidFrom = nil
+	p.idleStage = idleActive
+	p.lock.Unlock(ctx)
+	if from == nil {
+		return
+	}
+
+	// The room may have been deleted while the player was away.
+	if Atlas.GetRoomByUUID(from.Data.UUID) != from {
+		from = Atlas.GetRoom(0, 0, 0)
+	}
+	p.ToRoom(ctx, from)
+	p.Write(ctx, "You return from the void.")
+	from.AllPlayers(ctx, func(uuid string, rp *Player) {
+		if rp == p {
+			return
+		}
+		rp.Write(ctx, "%s returns from the void.", p.GetName(ctx))
+	})
+}
+
+// idleDisconnect saves an idle player and removes them from the world.
+func (p *Player) idleDisconnect(ctx context.Context) {
+	log.Info().Str("player", p.GetName(ctx)).Msg("Disconnecting idle player.")
+	p.Write(ctx, "You have been idle for too long, goodbye.")
+	room := p.GetRoom(ctx)
+	p.Stop(ctx)
+	if room == nil {
+		return
+	}
+	room.AllPlayers(ctx, func(uuid string, rp *Player) {
+		rp.Write(ctx, "%s exits this realm before your eyes.", p.GetName(ctx))
+	})
+}
@@ -0,0 +1,63 @@
+package construct
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/lock"
+	"github.com/stretchr/testify/assert"
+)
+
+func testFindPlayer(t *testing.T, name string) *Player {
+	t.Helper()
+	var p *Player
+	assert.Eventually(t, func() bool {
+		p = Atlas.GetPlayer(name)
+		return p != nil
+	}, time.Second*5, time.Millisecond*10)
+	return p
+}
+
+func TestIdleVoidAndReturn(t *testing.T) {
+	testSetupWorld(t)
+	config.Set("idle_warn", "1s")
+	config.Set("idle_void", "2s")
+	t.Cleanup(func() {
+		config.Set("idle_warn", "10m")
+		config.Set("idle_void", "15m")
+	})
+	r, w := testLoginNewUser(t, "Idler")
+	p := testFindPlayer(t, "Idler")
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+	assert.Eventually(t, func() bool {
+		return p.GetRoom(ctx) != nil
+	}, time.Second*5, time.Millisecond*10)
+	start := p.GetRoom(ctx)
+
+	assert.Eventually(t, func() bool {
+		return p.GetRoom(ctx) == Atlas.Void()
+	}, time.Second*10, time.Millisecond*50)
+	// Idle players are saved in the room they left.
+	assert.Equal(t, start.Data.UUID, p.GetData(ctx).Room)
+	assert.Nil(t, Atlas.GetRoomByUUID(Atlas.Void().Data.UUID))
+
+	runCommands(t, r, w, []string{"look"})
+	assert.Eventually(t, func() bool {
+		return p.GetRoom(ctx) == start
+	}, time.Second*5, time.Millisecond*10)
+}
+
+func TestIdleLimitsEditorGrace(t *testing.T) {
+	p := NewPlayer()
+	p.newInterps()
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+	warn, void, disconnect := p.idleLimits(ctx)
+	assert.Equal(t, config.GetDuration("idle_warn"), warn)
+	assert.Equal(t, config.GetDuration("idle_void"), void)
+	assert.Equal(t, config.GetDuration("idle_disconnect"), disconnect)
+
+	p.setInterp(ctx, p.textInterp)
+	_, _, editing := p.idleLimits(ctx)
+	assert.Equal(t, disconnect+config.GetDuration("idle_editor_grace"), editing)
+}
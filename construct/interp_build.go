@@ -2,7 +2,11 @@ package construct
 
 import (
 	"context"
+	"errors"
 	"strings"
+
+	"github.com/Cidan/gomud/storage"
+	"github.com/rs/zerolog/log"
 )
 
 // BuildInterp is the builder interp, used for world crafting and modifying
@@ -18,19 +22,22 @@ func NewBuildInterp(p *Player) *BuildInterp {
 		p: p,
 	}
 
-	commands := newCommands()
+	commands := newCommands(p)
 	commands.Add(&command{
-		name: "dig",
-		Fn:   b.DoDig,
+		name:  "dig",
+		level: roleBuilder,
+		Fn:    b.DoDig,
 	}).Add(&command{
 		name: "build",
 		Fn:   b.DoBuild,
 	}).Add(&command{
-		name: "autobuild",
-		Fn:   b.Autobuild,
+		name:  "autobuild",
+		level: roleBuilder,
+		Fn:    b.Autobuild,
 	}).Add(&command{
-		name: "set",
-		Fn:   b.DoSet,
+		name:  "set",
+		level: roleBuilder,
+		Fn:    b.DoSet,
 	}).Add(&command{
 		name:  "north",
 		alias: []string{"n"},
@@ -56,8 +63,13 @@ func NewBuildInterp(p *Player) *BuildInterp {
 		alias: []string{"d"},
 		Fn:    b.DoDown,
 	}).Add(&command{
-		name: "edit",
-		Fn:   b.DoEdit,
+		name:  "edit",
+		level: roleBuilder,
+		Fn:    b.DoEdit,
+	}).Add(&command{
+		name:  "area",
+		level: roleBuilder,
+		Fn:    b.DoArea,
 	})
 	b.commands = commands
 	return b
@@ -79,12 +91,36 @@ func (b *BuildInterp) Read(ctx context.Context, text string) error {
 	return b.p.gameInterp.commands.Process(ctx, all[0], all[1:]...)
 }
 
+// canBuild returns true if the player may build in the area the room is
+// in, and tells them if they may not.
+func (b *BuildInterp) canBuild(ctx context.Context, room *Room) bool {
+	a, err := room.getArea()
+	if err != nil {
+		b.p.Write(ctx, "%s.", err)
+		return false
+	}
+	return b.canBuildArea(ctx, a)
+}
+
+// canBuildArea returns true if the player may build in the area, and tells
+// them if they may not. Anyone who can build may build outside of areas.
+func (b *BuildInterp) canBuildArea(ctx context.Context, a *Area) bool {
+	if a == nil || a.CanBuild(b.p.GetName(ctx), b.p.GetRole(ctx)) {
+		return true
+	}
+	b.p.Write(ctx, "You aren't one of the builders of %s.", a.GetName())
+	return false
+}
+
 func (b *BuildInterp) doDigDir(ctx context.Context, dir direction) error {
 	currentRoom := b.p.GetRoom(ctx)
 	if currentRoom.PhysicalRoom(dir) != nil {
 		b.p.Write(ctx, "There's already a room '%s'.\n", Atlas.dirToName(dir))
 		return nil
 	}
+	if !b.canBuild(ctx, currentRoom) {
+		return nil
+	}
 
 	rX, rY, rZ := Atlas.getRelativeDir(dir)
 
@@ -93,6 +129,15 @@ func (b *BuildInterp) doDigDir(ctx context.Context, dir direction) error {
 	room.Data.Y = currentRoom.Data.Y + rY
 	room.Data.Z = currentRoom.Data.Z + rZ
 
+	// Rooms dug inside an area's box join the area.
+	area := Atlas.AreaAt(room.Data.X, room.Data.Y, room.Data.Z)
+	if !b.canBuildArea(ctx, area) {
+		return nil
+	}
+	if area != nil {
+		room.Data.Area = area.GetID()
+	}
+
 	for _, exitDir := range exitDirections {
 		if inverseDirections[dir] == exitDir {
 			room.SetExitRoom(ctx, exitDir, currentRoom)
@@ -103,11 +148,11 @@ func (b *BuildInterp) doDigDir(ctx context.Context, dir direction) error {
 	currentRoom.Exit(ctx, dir).Wall = false
 	currentRoom.SetExitRoom(ctx, dir, room)
 
-	if err := room.Save(); err != nil {
+	if err := room.markDirty(); err != nil {
 		return err
 	}
 
-	if err := currentRoom.Save(); err != nil {
+	if err := currentRoom.markDirty(); err != nil {
 		return err
 	}
 
@@ -238,6 +283,9 @@ func (b *BuildInterp) setRoom(ctx context.Context, args ...string) error {
 		p.Write(ctx, "What do you want to set on the room?")
 		return nil
 	}
+	if !b.canBuild(ctx, room) {
+		return nil
+	}
 	args = strings.SplitN(args[0], " ", 2)
 	switch args[0] {
 	case "name":
@@ -247,7 +295,7 @@ func (b *BuildInterp) setRoom(ctx context.Context, args ...string) error {
 		}
 		room.SetName(args[1])
 		p.Write(ctx, "Name set.")
-		return room.Save()
+		return room.markDirty()
 	case "description":
 		if len(args) < 2 {
 			p.Write(ctx, "What do you want to set the description to?")
@@ -255,7 +303,7 @@ func (b *BuildInterp) setRoom(ctx context.Context, args ...string) error {
 		}
 		room.SetDescription(args[1])
 		p.Write(ctx, "Description set.")
-		return room.Save()
+		return room.markDirty()
 	default:
 		p.Write(ctx, "There's no such room property to set.")
 		return nil
@@ -283,6 +331,9 @@ func (b *BuildInterp) DoEdit(ctx context.Context, args ...string) error {
 func (b *BuildInterp) editRoom(ctx context.Context, field string) error {
 	p := b.p
 	room := p.GetRoom(ctx)
+	if !b.canBuild(ctx, room) {
+		return nil
+	}
 	var ectx context.Context
 	switch field {
 	case "name":
@@ -295,7 +346,7 @@ func (b *BuildInterp) editRoom(ctx context.Context, field string) error {
 	p.Write(ctx, "You are now editing text. Type :q to quit, :w to save, and :? for help.")
 	go func(ctx context.Context, room *Room) {
 		<-ectx.Done()
-		room.Save()
+		room.markDirty()
 		p.setInterp(ectx, p.buildInterp)
 		p.Command("look")
 	}(ectx, room)
@@ -310,3 +361,235 @@ func (b *BuildInterp) editRoom(ctx context.Context, field string) error {
 	*/
 	return nil
 }
+
+// DoArea lists and manages areas. Only the builders of an area may change
+// it.
+func (b *BuildInterp) DoArea(ctx context.Context, args ...string) error {
+	p := b.p
+	var fields []string
+	if len(args) > 0 {
+		fields = strings.Fields(args[0])
+	}
+	if len(fields) == 0 || fields[0] == "list" {
+		return b.listAreas(ctx)
+	}
+	sub := fields[0]
+	if sub == "assign" {
+		if len(fields) != 2 {
+			p.Write(ctx, "Syntax: area assign <area|none>")
+			return nil
+		}
+		return b.assignArea(ctx, fields[1])
+	}
+	if len(fields) < 2 {
+		p.Write(ctx, "Syntax: area [list|info|create|set|builder|assign|save|load|reload] <area> ...")
+		return nil
+	}
+	id := strings.ToLower(fields[1])
+	switch sub {
+	case "create":
+		if len(fields) < 3 {
+			p.Write(ctx, "Syntax: area create <area> <name>")
+			return nil
+		}
+		return b.createArea(ctx, id, strings.Join(fields[2:], " "))
+	case "load":
+		a, err := LoadArea(ctx, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			p.Write(ctx, "There is no saved area %s.", id)
+			return nil
+		}
+		if err != nil {
+			p.Write(ctx, "Unable to load %s: %s.", id, err)
+			return nil
+		}
+		log.Info().Str("area", id).Str("by", p.GetName(ctx)).Msg("Area loaded.")
+		p.Write(ctx, "Loaded %s, with %d rooms.", a.GetName(), a.RoomCount())
+		return nil
+	}
+
+	a := Atlas.GetArea(id)
+	if a == nil {
+		p.Write(ctx, "There is no area %s.", id)
+		return nil
+	}
+	switch sub {
+	case "info":
+		d := a.info()
+		p.Write(ctx, "%s (%s), %d rooms", d.Name, d.ID, a.RoomCount())
+		p.Write(ctx, "Bounds: %s to %s", formatCoordinates(d.Min), formatCoordinates(d.Max))
+		builders := "anyone"
+		if len(d.Builders) > 0 {
+			builders = strings.Join(d.Builders, ", ")
+		}
+		p.Write(ctx, "Builders: %s", builders)
+		if d.Credits != "" {
+			p.Write(ctx, "Credits: %s", d.Credits)
+		}
+		if d.Description != "" {
+			p.Write(ctx, "%s", d.Description)
+		}
+		return nil
+	}
+	if !b.canBuildArea(ctx, a) {
+		return nil
+	}
+	switch sub {
+	case "set":
+		return b.setArea(ctx, a, fields[2:]...)
+	case "builder":
+		if len(fields) != 3 {
+			p.Write(ctx, "Syntax: area builder <area> <character>")
+			return nil
+		}
+		if err := validNameFormat(fields[2]); err != nil {
+			p.Write(ctx, "%s is not a valid name.", fields[2])
+			return nil
+		}
+		if a.ToggleBuilder(fields[2]) {
+			p.Write(ctx, "%s is now a builder of %s.", normalizeName(fields[2]), a.GetName())
+		} else {
+			p.Write(ctx, "%s is no longer a builder of %s.", normalizeName(fields[2]), a.GetName())
+		}
+		a.markDirty()
+		return nil
+	case "save":
+		if err := a.Save(); err != nil {
+			p.Write(ctx, "Unable to save %s.", a.GetName())
+			return err
+		}
+		forgetSave("area:" + id)
+		p.Write(ctx, "Saved %s.", a.GetName())
+		return nil
+	case "reload":
+		a, err := ReloadArea(ctx, id)
+		if err != nil {
+			p.Write(ctx, "Unable to reload %s: %s.", id, err)
+			return nil
+		}
+		log.Info().Str("area", id).Str("by", p.GetName(ctx)).Msg("Area reloaded.")
+		p.Write(ctx, "Reloaded %s, with %d rooms.", a.GetName(), a.RoomCount())
+		return nil
+	default:
+		p.Write(ctx, "There's no such area command.")
+		return nil
+	}
+}
+
+// listAreas shows every area in the world.
+func (b *BuildInterp) listAreas(ctx context.Context) error {
+	areas := Atlas.Areas()
+	if len(areas) == 0 {
+		b.p.Write(ctx, "There are no areas.")
+	}
+	for _, a := range areas {
+		d := a.info()
+		b.p.Write(ctx, "%-16s %-30s %5d rooms  %s to %s", d.ID, d.Name, a.RoomCount(), formatCoordinates(d.Min), formatCoordinates(d.Max))
+	}
+	return nil
+}
+
+// createArea creates an area holding the room the player is in, with a box
+// of just that room to start with.
+func (b *BuildInterp) createArea(ctx context.Context, id, name string) error {
+	p := b.p
+	room := p.GetRoom(ctx)
+	if err := validAreaFormat(id); err != nil {
+		p.Write(ctx, "%s.", err)
+		return nil
+	}
+	if Atlas.GetArea(id) != nil {
+		p.Write(ctx, "There is already an area %s.", id)
+		return nil
+	}
+	if _, err := loadRecord(storage.Areas, id); err == nil {
+		p.Write(ctx, "There is already a saved area %s, load it instead.", id)
+		return nil
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		p.Write(ctx, "Unable to read the saved areas.")
+		return err
+	}
+	if !b.canBuild(ctx, room) {
+		return nil
+	}
+	a := NewArea(id, name)
+	a.SetBounds(
+		[3]int64{room.Data.X, room.Data.Y, room.Data.Z},
+		[3]int64{room.Data.X, room.Data.Y, room.Data.Z},
+	)
+	Atlas.AddArea(a)
+	if err := room.setArea(a); err != nil {
+		p.Write(ctx, "Unable to save %s.", name)
+		return err
+	}
+	log.Info().Str("area", id).Str("by", p.GetName(ctx)).Msg("Area created.")
+	p.Write(ctx, "Created %s, holding this room.", name)
+	return nil
+}
+
+// setArea sets the name, description, credits or bounds of an area.
+func (b *BuildInterp) setArea(ctx context.Context, a *Area, args ...string) error {
+	p := b.p
+	if len(args) < 2 {
+		p.Write(ctx, "Syntax: area set <area> <name|description|credits|bounds> <value>")
+		return nil
+	}
+	value := strings.Join(args[1:], " ")
+	switch args[0] {
+	case "name":
+		a.update(func(d *AreaData) { d.Name = value })
+	case "description":
+		a.update(func(d *AreaData) { d.Description = value })
+	case "credits":
+		a.update(func(d *AreaData) { d.Credits = value })
+	case "bounds":
+		if len(args) != 7 {
+			p.Write(ctx, "Syntax: area set <area> bounds <x1> <y1> <z1> <x2> <y2> <z2>")
+			return nil
+		}
+		from, err := parseCoordinates(args[1:4])
+		if err != nil {
+			p.Write(ctx, "%s.", err)
+			return nil
+		}
+		to, err := parseCoordinates(args[4:7])
+		if err != nil {
+			p.Write(ctx, "%s.", err)
+			return nil
+		}
+		a.SetBounds(from, to)
+	default:
+		p.Write(ctx, "There's no such area property to set.")
+		return nil
+	}
+	a.markDirty()
+	p.Write(ctx, "Set the %s of %s.", args[0], a.GetName())
+	return nil
+}
+
+// assignArea moves the room the player is in to an area, or out of any
+// area.
+func (b *BuildInterp) assignArea(ctx context.Context, id string) error {
+	p := b.p
+	room := p.GetRoom(ctx)
+	var a *Area
+	if id != "none" {
+		if a = Atlas.GetArea(strings.ToLower(id)); a == nil {
+			p.Write(ctx, "There is no area %s.", id)
+			return nil
+		}
+	}
+	if !b.canBuild(ctx, room) || !b.canBuildArea(ctx, a) {
+		return nil
+	}
+	if err := room.setArea(a); err != nil {
+		p.Write(ctx, "Unable to save the room.")
+		return err
+	}
+	if a == nil {
+		p.Write(ctx, "This room is no longer in an area.")
+		return nil
+	}
+	p.Write(ctx, "This room is now in %s.", a.GetName())
+	return nil
+}
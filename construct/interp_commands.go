@@ -12,15 +12,19 @@ type Interp interface {
 	Read(context.Context, string) error
 }
 
+// command is a single command. level is the role a player needs to use
+// the command, commands above a player's role act as if they don't exist.
 type command struct {
 	name  string
 	alias []string
 	state []string
+	level role
 	Fn    commandCallback
 }
 
 // CommandMap is the top level object for commands
 type commandMap struct {
+	p        *Player
 	commands map[string]*command
 }
 
@@ -29,8 +33,9 @@ var (
 	ErrCommandNotFound = fmt.Errorf("command does not exist")
 )
 
-func newCommands() *commandMap {
+func newCommands(p *Player) *commandMap {
 	return &commandMap{
+		p:        p,
 		commands: make(map[string]*command),
 	}
 }
@@ -48,8 +53,8 @@ func (c *commandMap) Add(nc *command) *commandMap {
 }
 
 func (c *commandMap) Process(ctx context.Context, command string, input ...string) error {
-	if c.commands[command] != nil {
-		return c.commands[command].Fn(ctx, input...)
+	if nc := c.commands[command]; nc != nil && c.p.GetRole(ctx) >= nc.level {
+		return nc.Fn(ctx, input...)
 	}
 
 	return ErrCommandNotFound
@@ -5,6 +5,10 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/Cidan/gomud/lock"
+	"github.com/rs/zerolog/log"
 )
 
 // Game interp for handling user login
@@ -20,7 +24,7 @@ func NewGameInterp(p *Player) *Game {
 		p: p,
 	}
 
-	commands := newCommands()
+	commands := newCommands(p)
 	commands.Add(&command{
 		name:  "look",
 		alias: []string{"l"},
@@ -32,8 +36,9 @@ func NewGameInterp(p *Player) *Game {
 		name: "quit",
 		Fn:   g.DoQuit,
 	}).Add(&command{
-		name: "build",
-		Fn:   g.DoBuild,
+		name:  "build",
+		level: roleBuilder,
+		Fn:    g.DoBuild,
 	}).Add(&command{
 		name:  "north",
 		alias: []string{"n"},
@@ -64,6 +69,47 @@ func NewGameInterp(p *Player) *Game {
 	}).Add(&command{
 		name: "color",
 		Fn:   g.DoColor,
+	}).Add(&command{
+		name: "compress",
+		Fn:   g.DoCompress,
+	}).Add(&command{
+		name: "account",
+		Fn:   g.DoAccount,
+	}).Add(&command{
+		name: "password",
+		Fn:   g.DoPassword,
+	}).Add(&command{
+		name:  "reboot",
+		level: roleAdmin,
+		Fn:    g.DoReboot,
+	}).Add(&command{
+		name:  "ban",
+		level: roleAdmin,
+		Fn:    g.DoBan,
+	}).Add(&command{
+		name:  "unban",
+		level: roleAdmin,
+		Fn:    g.DoUnban,
+	}).Add(&command{
+		name:  "reserve",
+		level: roleAdmin,
+		Fn:    g.DoReserve,
+	}).Add(&command{
+		name:  "unreserve",
+		level: roleAdmin,
+		Fn:    g.DoUnreserve,
+	}).Add(&command{
+		name:  "restore",
+		level: roleAdmin,
+		Fn:    g.DoRestore,
+	}).Add(&command{
+		name:  "promote",
+		level: roleAdmin,
+		Fn:    g.DoPromote,
+	}).Add(&command{
+		name:  "demote",
+		level: roleAdmin,
+		Fn:    g.DoDemote,
 	}).Add(&command{
 		name: "say",
 		Fn:   g.DoSay,
@@ -276,6 +322,7 @@ func (g *Game) DoPrompt(ctx context.Context, args ...string) error {
 		return nil
 	}
 	g.p.SetPrompt(strings.Join(args, " "))
+	g.p.markDirty(ctx)
 	g.p.Write(ctx, "Prompt set.")
 	return nil
 }
@@ -290,6 +337,439 @@ func (g *Game) DoColor(ctx context.Context, args ...string) error {
 	return nil
 }
 
+// DoCompress will toggle output compression for a player.
+func (g *Game) DoCompress(ctx context.Context, args ...string) error {
+	p := g.p
+	if p.wantsCompression(ctx) {
+		p.DisableFlag(ctx, "compress")
+		p.Write(ctx, "Compression disabled.")
+	} else {
+		p.EnableFlag(ctx, "compress")
+		p.Write(ctx, "Compression enabled, if your client supports it.")
+	}
+	p.applyCompression(ctx)
+	return nil
+}
+
+// accountSettings are the flags that may be set for a whole account.
+var accountSettings = []string{"color", "prompt", "compress"}
+
+// DoAccount lists the account wide settings, or makes the player's current
+// setting apply to every character on their account. "clear" lets each
+// character choose for themselves again.
+func (g *Game) DoAccount(ctx context.Context, args ...string) error {
+	p := g.p
+	a := p.GetAccount(ctx)
+	if a == nil {
+		p.Write(ctx, "This character doesn't belong to an account.")
+		return nil
+	}
+	if len(args) == 0 {
+		flags := a.Flags()
+		var b strings.Builder
+		b.WriteString("Account wide settings:")
+		for _, key := range accountSettings {
+			setting := "not set"
+			if on, ok := flags[key]; ok && on {
+				setting = "on"
+			} else if ok {
+				setting = "off"
+			}
+			fmt.Fprintf(&b, "\n  %-10s %s", key, setting)
+		}
+		p.Write(ctx, "%s", b.String())
+		return nil
+	}
+
+	fields := strings.Fields(args[0])
+	key := strings.ToLower(fields[0])
+	valid := false
+	for _, s := range accountSettings {
+		valid = valid || s == key
+	}
+	if !valid || len(fields) > 2 || (len(fields) == 2 && fields[1] != "clear") {
+		p.Write(ctx, "Usage: account [%s] [clear]", strings.Join(accountSettings, "|"))
+		return nil
+	}
+	if len(fields) == 2 {
+		a.ClearFlag(key)
+		if err := a.Save(); err != nil {
+			return err
+		}
+		p.Write(ctx, "Each of your characters now has their own %s setting.", key)
+		return nil
+	}
+	on := p.Flag(ctx, key)
+	if key == "compress" {
+		on = p.wantsCompression(ctx)
+	}
+	a.SetFlag(key, on)
+	if err := a.Save(); err != nil {
+		return err
+	}
+	state := "off"
+	if on {
+		state = "on"
+	}
+	p.Write(ctx, "Your %s setting is now %s for every character on your account.", key, state)
+	return nil
+}
+
+// DoPassword starts a password change for the player.
+func (g *Game) DoPassword(ctx context.Context, args ...string) error {
+	return g.p.passwordInterp.Start(ctx)
+}
+
+// DoReboot saves the world and restarts the server in place, keeping every
+// player connected.
+func (g *Game) DoReboot(ctx context.Context, args ...string) error {
+	p := g.p
+	if Atlas.ShuttingDown() {
+		p.Write(ctx, "The realm is already shutting down.")
+		return nil
+	}
+	// The reboot needs every player's lock, including ours, so run it once
+	// this command has returned.
+	go func() {
+		if err := Atlas.Copyover(); err != nil {
+			ctx := lock.Context(p.Context(), p.GetUUID(p.Context())+"reboot")
+			p.Write(ctx, "Reboot failed: %s", err)
+		}
+	}()
+	return nil
+}
+
+// DoBan bans a site or a name, or lists every ban when given no arguments.
+// Bans last for good unless given a duration.
+func (g *Game) DoBan(ctx context.Context, args ...string) error {
+	p := g.p
+	if len(args) == 0 {
+		list, err := bans.list()
+		if len(list) == 0 {
+			p.Write(ctx, "There are no bans.")
+		}
+		for i, b := range list {
+			expires := "permanent"
+			if !b.Permanent() {
+				expires = formatBanTime(time.Until(b.Expires)) + " left"
+			}
+			p.Write(ctx, "%2d) %s %s by %s, %s: %s", i+1, b.Kind, b.Target, b.By, expires, b.Reason)
+		}
+		return err
+	}
+
+	fields := strings.Fields(args[0])
+	if len(fields) < 3 {
+		p.Write(ctx, "Syntax: ban <site|name> <target> [duration] <reason>")
+		return nil
+	}
+	kind, target, rest := strings.ToLower(fields[0]), fields[1], fields[2:]
+	if err := validBanTarget(kind, target); err != nil {
+		p.Write(ctx, "You can't ban that: %s.", err)
+		return nil
+	}
+	b := &Ban{
+		Kind:    kind,
+		Target:  target,
+		By:      p.GetName(ctx),
+		Created: time.Now(),
+	}
+	if d, err := parseBanDuration(rest[0]); err == nil && len(rest) > 1 {
+		b.Expires = b.Created.Add(d)
+		rest = rest[1:]
+	}
+	b.Reason = strings.Join(rest, " ")
+	if err := bans.add(b); err != nil {
+		p.Write(ctx, "Unable to save the ban list.")
+		return err
+	}
+	log.Info().Str("kind", b.Kind).Str("target", b.Target).Str("by", b.By).Time("expires", b.Expires).Str("reason", b.Reason).Msg("Ban added.")
+	p.Write(ctx, "Banned %s %s.", b.Kind, b.Target)
+
+	// Anyone already in the world who is covered by the ban is thrown out.
+	Atlas.AllPlayers(func(rp *Player) {
+		if rp == p {
+			return
+		}
+		rctx := lock.Context(rp.Context(), rp.GetUUID(rp.Context())+"ban")
+		if !b.covers(rctx, rp) {
+			return
+		}
+		rp.Write(rctx, "%s", b.Message())
+		rp.Stop(rctx)
+		p.Write(ctx, "%s has been disconnected.", rp.GetName(rctx))
+	})
+	return nil
+}
+
+// DoUnban removes a ban, by its number in the ban list or by its target.
+func (g *Game) DoUnban(ctx context.Context, args ...string) error {
+	p := g.p
+	if len(args) == 0 {
+		p.Write(ctx, "Syntax: unban <number|target>")
+		return nil
+	}
+	b, err := bans.remove(strings.TrimSpace(args[0]))
+	if err != nil {
+		p.Write(ctx, "Unable to save the ban list.")
+		return err
+	}
+	if b == nil {
+		p.Write(ctx, "There is no such ban.")
+		return nil
+	}
+	log.Info().Str("kind", b.Kind).Str("target", b.Target).Str("by", p.GetName(ctx)).Msg("Ban removed.")
+	p.Write(ctx, "Removed the ban on %s %s.", b.Kind, b.Target)
+	return nil
+}
+
+// DoReserve reserves a name so that new accounts and characters can't take
+// it, or lists every reserved name when given no arguments. A name may be
+// held for an account, which is then the only one that may take it.
+func (g *Game) DoReserve(ctx context.Context, args ...string) error {
+	p := g.p
+	if len(args) == 0 {
+		list := listReservedNames()
+		if len(list) == 0 {
+			p.Write(ctx, "There are no reserved names.")
+		}
+		for _, r := range list {
+			if r.For != "" {
+				p.Write(ctx, "%s, held for %s by %s", r.Name, r.For, r.By)
+			} else {
+				p.Write(ctx, "%s, reserved by %s", r.Name, r.By)
+			}
+		}
+		return nil
+	}
+
+	fields := strings.Fields(args[0])
+	if len(fields) > 2 {
+		p.Write(ctx, "Syntax: reserve <name> [account]")
+		return nil
+	}
+	r := &reservation{
+		Name:    normalizeName(fields[0]),
+		By:      p.GetName(ctx),
+		Created: time.Now(),
+	}
+	if len(fields) == 2 {
+		r.For = normalizeName(fields[1])
+	}
+	if err := validNameFormat(r.Name); err != nil {
+		p.Write(ctx, "%s is not a valid name.", fields[0])
+		return nil
+	}
+	if err := reserveName(r); err != nil {
+		p.Write(ctx, "Unable to save the reserved names.")
+		return err
+	}
+	log.Info().Str("name", r.Name).Str("for", r.For).Str("by", r.By).Msg("Name reserved.")
+	p.Write(ctx, "%s is now reserved.", r.Name)
+	return nil
+}
+
+// DoUnreserve frees a reserved name.
+func (g *Game) DoUnreserve(ctx context.Context, args ...string) error {
+	p := g.p
+	if len(args) == 0 {
+		p.Write(ctx, "Syntax: unreserve <name>")
+		return nil
+	}
+	r, err := unreserveName(strings.TrimSpace(args[0]))
+	if err != nil {
+		p.Write(ctx, "Unable to save the reserved names.")
+		return err
+	}
+	if r == nil {
+		p.Write(ctx, "That name isn't reserved.")
+		return nil
+	}
+	log.Info().Str("name", r.Name).Str("by", p.GetName(ctx)).Msg("Name unreserved.")
+	p.Write(ctx, "%s is no longer reserved.", r.Name)
+	return nil
+}
+
+// DoRestore lists a character's backups, or rolls the character back to
+// one of them. A character in the world is saved and removed first.
+func (g *Game) DoRestore(ctx context.Context, args ...string) error {
+	p := g.p
+	var fields []string
+	if len(args) > 0 {
+		fields = strings.Fields(args[0])
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		p.Write(ctx, "Syntax: restore <character> [backup]")
+		return nil
+	}
+	name := normalizeName(fields[0])
+	backups, err := playerBackups(name)
+	if err != nil {
+		p.Write(ctx, "Unable to read the backups.")
+		return err
+	}
+	if len(backups) == 0 {
+		p.Write(ctx, "There are no backups of %s.", name)
+		return nil
+	}
+	if len(fields) == 1 {
+		p.Write(ctx, "Backups of %s, newest first:", name)
+		for i, b := range backups {
+			p.Write(ctx, "%2d) %s, %s ago", i+1, b.Created.Local().Format("2006-01-02 15:04:05"), formatBanTime(time.Since(b.Created)))
+		}
+		return nil
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil || n < 1 || n > len(backups) {
+		p.Write(ctx, "There is no such backup.")
+		return nil
+	}
+	b := backups[n-1]
+	data, err := loadBackup(name, b)
+	if err != nil {
+		p.Write(ctx, "Unable to read that backup.")
+		return err
+	}
+
+	// Restoring may also change the character's role, so it is held to
+	// the same rules as promoting them.
+	current, found, err := loadPlayerData(name)
+	if err != nil {
+		p.Write(ctx, "Unable to load that character.")
+		return err
+	}
+	from := rolePlayer
+	if found {
+		from = current.Role
+	}
+	if err := canChangeRole(p.GetRole(ctx), from, data.Role); err != nil {
+		p.Write(ctx, "%s", err)
+		return nil
+	}
+
+	if target := Atlas.GetPlayer(name); target != nil {
+		if target == p {
+			p.Write(ctx, "You can't restore yourself.")
+			return nil
+		}
+		tctx := lock.Context(target.Context(), target.GetUUID(target.Context())+"restore")
+		target.Write(tctx, "{YYour character is being restored from a backup, please reconnect in a moment.{x")
+		target.Stop(tctx)
+	}
+	// The character as it is now is backed up as it is overwritten, so a
+	// restore can itself be undone.
+	if err := savePlayerData(data); err != nil {
+		p.Write(ctx, "Unable to restore %s.", name)
+		return err
+	}
+	// A deleted character was also taken off their account, and can't be
+	// played until they are back on it.
+	if err := addAccountCharacter(data.Account, data.UUID, data.Name); err != nil {
+		p.Write(ctx, "%s was restored, but couldn't be put back on their account.", name)
+		return err
+	}
+	log.Warn().
+		Str("player", name).
+		Str("by", p.GetName(ctx)).
+		Time("backup", b.Created).
+		Msg("Player restored from backup.")
+	p.Write(ctx, "%s has been restored from the backup of %s.", name, b.Created.Local().Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// DoPromote raises a character to a higher role.
+func (g *Game) DoPromote(ctx context.Context, args ...string) error {
+	return g.changeRole(ctx, "promote", args...)
+}
+
+// DoDemote lowers a character to a lower role, or to a player if no role is
+// given.
+func (g *Game) DoDemote(ctx context.Context, args ...string) error {
+	return g.changeRole(ctx, "demote", args...)
+}
+
+// changeRole promotes or demotes a character, who may be offline.
+func (g *Game) changeRole(ctx context.Context, change string, args ...string) error {
+	p := g.p
+	var fields []string
+	if len(args) > 0 {
+		fields = strings.Fields(args[0])
+	}
+	if len(fields) == 1 && change == "demote" {
+		fields = append(fields, rolePlayer.String())
+	}
+	if len(fields) != 2 {
+		p.Write(ctx, "Syntax: %s <character> <%s>", change, strings.Join(roleNames, "|"))
+		return nil
+	}
+	to, err := parseRole(fields[1])
+	if err != nil {
+		p.Write(ctx, "There is no such role.")
+		return nil
+	}
+
+	// Change the character in the world if they are on, otherwise change
+	// their pfile.
+	target := Atlas.GetPlayer(fields[0])
+	var tctx context.Context
+	var data *playerData
+	var from role
+	if target != nil {
+		tctx = lock.Context(target.Context(), target.GetUUID(target.Context())+"role")
+		from = target.GetRole(tctx)
+	} else {
+		var found bool
+		data, found, err = loadPlayerData(fields[0])
+		if err != nil {
+			p.Write(ctx, "Unable to load that character.")
+			return err
+		}
+		if !found {
+			p.Write(ctx, "There is no such character.")
+			return nil
+		}
+		from = data.Role
+	}
+	if target == p {
+		p.Write(ctx, "You can't change your own role.")
+		return nil
+	}
+	if change == "promote" && to <= from || change == "demote" && to >= from {
+		p.Write(ctx, "That wouldn't %s them, they are already %s.", change, from)
+		return nil
+	}
+	if err := canChangeRole(p.GetRole(ctx), from, to); err != nil {
+		p.Write(ctx, "%s", err)
+		return nil
+	}
+
+	var name string
+	if target != nil {
+		target.setRole(tctx, to)
+		if err := target.Save(tctx); err != nil {
+			p.Write(ctx, "Unable to save that character.")
+			return err
+		}
+		name = target.GetName(tctx)
+		target.Write(tctx, "{YYou have been %sd to %s by %s.{x", change, to, p.GetName(ctx))
+	} else {
+		data.Role = to
+		if err := savePlayerData(data); err != nil {
+			p.Write(ctx, "Unable to save that character.")
+			return err
+		}
+		name = data.Name
+	}
+	log.Warn().
+		Str("player", name).
+		Str("by", p.GetName(ctx)).
+		Str("from", from.String()).
+		Str("to", to.String()).
+		Msgf("Player %sd.", change)
+	p.Write(ctx, "%s is now %s.", name, to)
+	return nil
+}
+
 // DoMap will display a map with a given radius around the player.
 func (g *Game) DoMap(ctx context.Context, args ...string) error {
 	var radius int64
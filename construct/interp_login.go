@@ -2,19 +2,30 @@ package construct
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
-	"time"
 
+	"github.com/Cidan/gomud/config"
 	"github.com/Cidan/gomud/state"
+	"github.com/Cidan/gomud/storage"
+	"github.com/rs/zerolog/log"
 )
 
 var RegexValidName = regexp.MustCompile(`^[a-zA-Z']+$`).MatchString
 
 // Login interp for handling user login
 type Login struct {
-	p     *Player
-	state *state.State
+	p          *Player
+	state      *state.State
+	account    *Account
+	legacy     *playerData
+	pending    string
+	race       *race
+	class      *class
+	attributes *playerAttributes
 }
 
 // NewLoginInterp creates a new login interp to handle user login and character creation.
@@ -32,6 +43,10 @@ func NewLoginInterp(p *Player) *Login {
 			Name: "ASK_PASSWORD",
 			Fn:   l.AskPassword,
 		}).
+		Add(&state.Event{
+			Name: "MIGRATE_PASSWORD",
+			Fn:   l.MigratePassword,
+		}).
 		Add(&state.Event{
 			Name: "CONFIRM_NAME",
 			Fn:   l.ConfirmName,
@@ -43,6 +58,46 @@ func NewLoginInterp(p *Player) *Login {
 		Add(&state.Event{
 			Name: "CONFIRM_PASSWORD",
 			Fn:   l.ConfirmPassword,
+		}).
+		Add(&state.Event{
+			Name: "ACCOUNT_MENU",
+			Fn:   l.AccountMenu,
+		}).
+		Add(&state.Event{
+			Name: "NEW_CHARACTER",
+			Fn:   l.NewCharacter,
+		}).
+		Add(&state.Event{
+			Name: "CONFIRM_CHARACTER",
+			Fn:   l.ConfirmCharacter,
+		}).
+		Add(&state.Event{
+			Name: "CHOOSE_RACE",
+			Fn:   l.ChooseRace,
+		}).
+		Add(&state.Event{
+			Name: "CHOOSE_CLASS",
+			Fn:   l.ChooseClass,
+		}).
+		Add(&state.Event{
+			Name: "CHOOSE_ATTRIBUTES",
+			Fn:   l.ChooseAttributes,
+		}).
+		Add(&state.Event{
+			Name: "ROLL_ATTRIBUTES",
+			Fn:   l.RollAttributes,
+		}).
+		Add(&state.Event{
+			Name: "BUY_ATTRIBUTES",
+			Fn:   l.BuyAttributes,
+		}).
+		Add(&state.Event{
+			Name: "CONFIRM_CREATION",
+			Fn:   l.ConfirmCreation,
+		}).
+		Add(&state.Event{
+			Name: "CONFIRM_DELETE",
+			Fn:   l.ConfirmDelete,
 		})
 	l.state = s
 	return l
@@ -52,89 +107,178 @@ func (l *Login) Read(ctx context.Context, text string) error {
 	return l.state.Process(ctx, text)
 }
 
-// ValidateName validates a name input and ensures users have valid names.
-func (l *Login) ValidateName(name string) bool {
-	if len(name) > 16 {
+// ValidateName checks that a new account or character may take a name. The
+// returned error is suitable for showing to the player.
+func (l *Login) ValidateName(name string) error {
+	owner := name
+	if l.account != nil {
+		owner = l.account.GetName()
+	}
+	return checkNewName(name, owner)
+}
+
+// refuseShutdown disconnects the player if the realm is shutting down.
+// Returns true if the player was refused.
+func (l *Login) refuseShutdown(ctx context.Context) bool {
+	if !Atlas.ShuttingDown() {
 		return false
 	}
+	l.disconnect(ctx, "The realm is shutting down, please try again shortly.")
+	return true
+}
 
-	if !RegexValidName(name) {
+// refuseBan disconnects the player if the name they gave is banned. Returns
+// true if the player was refused.
+func (l *Login) refuseBan(ctx context.Context, name string) bool {
+	ban := nameBan(name)
+	if ban == nil {
 		return false
 	}
+	log.Info().Str("name", name).Str("address", l.p.GetAddress(ctx)).Msg("Banned name refused.")
+	l.disconnect(ctx, ban.Message())
+	return true
+}
 
-	if strings.Count(name, `'`) > 1 {
+// refuseBackoff disconnects the player if they, or the account they are
+// logging in to, have failed to log in too recently. Returns true if the
+// player was refused.
+func (l *Login) refuseBackoff(ctx context.Context) bool {
+	wait := l.p.loginWait(ctx, l.account.GetUUID())
+	if wait <= 0 {
 		return false
 	}
+	l.disconnect(ctx, fmt.Sprintf("Too many failed logins, please try again in %s.", formatCountdown(wait)))
 	return true
 }
 
-// AskName step.
+// disconnect writes a message to the player and drops their connection.
+// The player never entered the world, so there's nothing to save.
+func (l *Login) disconnect(ctx context.Context, text string) {
+	l.p.Write(ctx, "%s", text)
+	l.p.cancel()
+}
+
+// pfileProblem returns what to tell a player whose pfile couldn't be
+// loaded.
+func pfileProblem(err error) string {
+	if errors.Is(err, ErrCorrupt) {
+		return "{RYour pfile is damaged. It has been set aside and the admins have been told, contact an admin to have it repaired.{x"
+	}
+	return "{RYour pfile couldn't be read right now. Please try again later, and contact an admin if it keeps happening.{x"
+}
+
+// AskName step, which asks for the account name.
 func (l *Login) AskName(ctx context.Context, text string) error {
+	if l.refuseShutdown(ctx) {
+		return nil
+	}
 	// Check for save
-	if !l.ValidateName(text) {
-		l.p.Write(ctx, "That is an invalid name. Your name may contain only a-zA-Z and a single apostophe, and must be less than 16 letters long.\n")
+	if err := validNameFormat(text); err != nil {
+		l.p.Write(ctx, "%s\n", err)
 		l.p.Write(ctx, "So then, what's your name?")
 		return nil
 	}
+	if l.refuseBan(ctx, text) {
+		return nil
+	}
 
-	l.p.SetName(ctx, text)
-	loaded, err := l.p.Load(ctx)
-	if err == nil && !loaded {
-		l.p.Write(ctx, "Are you sure you want to be known as %s?", text)
-		return l.state.SetState("CONFIRM_NAME")
+	account := NewAccount(text)
+	loaded, err := account.Load()
+	if err != nil {
+		l.disconnect(ctx, "Something went wrong trying to load your account, contact an admin.")
+		return err
+	}
+	l.account = account
+	if l.refuseBackoff(ctx) {
+		return nil
+	}
+	if loaded {
+		l.p.SetEcho(ctx, false)
+		l.p.Write(ctx, "Password: ")
+		return l.state.SetState("ASK_PASSWORD")
 	}
+
+	// Characters from before accounts existed log in with their own name
+	// and password, and are moved to an account of the same name.
+	legacy, found, err := loadPlayerData(text)
 	if err != nil {
-		l.p.Write(ctx, "Something went wrong trying to load your pfile, contact an admin.")
-		l.p.Stop(ctx)
+		l.disconnect(ctx, pfileProblem(err))
 		return err
 	}
-	l.p.Write(ctx, "Password: ")
-	return l.state.SetState("ASK_PASSWORD")
+	if found && legacy.Account == "" {
+		l.legacy = legacy
+		l.p.SetEcho(ctx, false)
+		l.p.Write(ctx, "Password: ")
+		return l.state.SetState("MIGRATE_PASSWORD")
+	}
+	if found {
+		l.p.Write(ctx, "That name belongs to a character, log in with the name of your account.\n")
+		l.p.Write(ctx, "So then, what's your name?")
+		return nil
+	}
+
+	// Only a brand new account name has to pass the naming rules, so that
+	// accounts from before a rule was added can still log in.
+	if err := l.ValidateName(text); err != nil {
+		l.account = nil
+		l.p.Write(ctx, "%s\n", err)
+		l.p.Write(ctx, "So then, what's your name?")
+		return nil
+	}
+	l.account = NewAccount(normalizeName(text))
+	l.p.Write(ctx, "Are you sure you want your account to be known as %s?", l.account.GetName())
+	return l.state.SetState("CONFIRM_NAME")
 }
 
 // AskPassword step.
 func (l *Login) AskPassword(ctx context.Context, text string) error {
-	if !l.p.IsPassword(text) {
-		l.p.Write(ctx, "Wrong password. Bye.")
-		l.p.Stop(ctx)
+	l.p.SetEcho(ctx, true)
+	if !l.account.IsPassword(text) {
+		log.Info().Str("account", l.account.GetName()).Str("address", l.p.GetAddress(ctx)).Msg("Wrong password on login.")
+		l.p.loginFailed(ctx, l.account.GetUUID())
+		l.disconnect(ctx, "Wrong password. Bye.")
 		return nil
 	}
-	// TODO(lobato): Add player to room before we atlas add player, make this atlas.getplayer and add only after room is not nil
-	if existingPlayer := Atlas.AddPlayer(ctx, l.p); existingPlayer != nil {
-		l.p.Write(ctx, "An existing player was found, disconnecting that player and attaching you to that session.")
-		existingPlayer.Disconnect()
-		// Quick hack to break the current connection input scanner, which will return
-		// false and break the read loop if a deadline passes.
-		//
-		// Heaven help us if this doesn't complete in less than a millisecond.
-		l.p.connection.SetReadDeadline(time.Now().Add(time.Nanosecond))
-		time.Sleep(time.Millisecond * 1)
-		l.p.connection.SetReadDeadline(time.Time{})
-
-		existingPlayer.SetConnection(ctx, l.p.connection)
-		l.p.connection = nil
-		l.p.cancel()
-		existingPlayer.Command("look")
+	l.p.loginSucceeded(ctx, l.account.GetUUID())
+	l.account.upgradePassword(text)
+	l.p.setAccount(ctx, l.account)
+	return l.showMenu(ctx)
+}
+
+// MigratePassword step, which checks the password of a character from
+// before accounts existed and moves it to a new account.
+func (l *Login) MigratePassword(ctx context.Context, text string) error {
+	l.p.SetEcho(ctx, true)
+	legacy := l.legacy
+	l.legacy = nil
+	if !checkPassword(legacy.Password, text) {
+		log.Info().Str("player", legacy.Name).Str("address", l.p.GetAddress(ctx)).Msg("Wrong password on login.")
+		l.p.loginFailed(ctx, l.account.GetUUID())
+		l.disconnect(ctx, "Wrong password. Bye.")
 		return nil
 	}
+	l.p.loginSucceeded(ctx, l.account.GetUUID())
 
-	l.p.Write(ctx, "Entering the world!")
-	if target := Atlas.GetRoomByUUID(l.p.Data.Room); target != nil {
-		l.p.ToRoom(ctx, target)
-	} else {
-		l.p.ToRoom(ctx, Atlas.GetRoom(0, 0, 0))
+	// The account is saved first, so the character is never left without
+	// one.
+	l.account.Data.Password = legacy.Password
+	l.account.AddCharacter(legacy.UUID, legacy.Name)
+	if err := l.account.Save(); err != nil {
+		l.disconnect(ctx, "Something went wrong creating your account, contact an admin.")
+		return err
 	}
+	l.account.upgradePassword(text)
+	legacy.Account = l.account.GetUUID()
+	legacy.Password = ""
+	if err := savePlayerData(legacy); err != nil {
+		l.disconnect(ctx, "Something went wrong saving your pfile, contact an admin.")
+		return err
+	}
+	log.Info().Str("account", l.account.GetName()).Msg("Moved character to a new account.")
 
-	l.p.Game(ctx)
-	l.p.GetRoom(ctx).AllPlayers(ctx, func(uuid string, p *Player) {
-		if p == l.p {
-			return
-		}
-		p.Write(ctx, "%s enters the realm before your eyes.", l.p.GetName(ctx))
-	})
-
-	l.p.Command("look")
-	return nil
+	l.p.setAccount(ctx, l.account)
+	l.p.Write(ctx, "{GYour character now belongs to an account named %s. Log in with the same name and password from now on.{x", l.account.GetName())
+	return l.showMenu(ctx)
 }
 
 // ConfirmName step.
@@ -144,35 +288,444 @@ func (l *Login) ConfirmName(ctx context.Context, text string) error {
 		return l.state.SetState("ASK_NAME")
 	}
 
-	l.p.Write(ctx, "Welcome %s, please give me a password: ", l.p.GetName(ctx))
+	l.p.SetEcho(ctx, false)
+	l.p.Write(ctx, "Welcome %s, please give me a password: ", l.account.GetName())
 	return l.state.SetState("NEW_PASSWORD")
 }
 
 // NewPassword step.
 func (l *Login) NewPassword(ctx context.Context, text string) error {
-	// TODO: validate password
-	l.p.SetPassword(text)
+	if err := validatePassword(l.account.GetName(), text); err != nil {
+		l.p.Write(ctx, "%s\nPlease give me a password: ", err)
+		return nil
+	}
+	l.account.SetPassword(text)
 	l.p.Write(ctx, "Confirm your password and type it again: ")
 	return l.state.SetState("CONFIRM_PASSWORD")
 }
 
-// ConfirmPassword step.
+// ConfirmPassword step, which creates the account.
 func (l *Login) ConfirmPassword(ctx context.Context, text string) error {
-	if !l.p.IsPassword(text) {
+	if !l.account.IsPassword(text) {
 		l.p.Write(ctx, "Passwords do not match\n")
 		l.p.Write(ctx, "Let's try this again. Please give me a new password: ")
 		return l.state.SetState("NEW_PASSWORD")
 	}
+	l.p.SetEcho(ctx, true)
+	if l.refuseShutdown(ctx) {
+		return nil
+	}
+	if err := l.account.Save(); err != nil {
+		l.disconnect(ctx, "Something went wrong creating your account, contact an admin.")
+		return err
+	}
+	log.Info().Str("account", l.account.GetName()).Msg("Account created.")
+	l.p.setAccount(ctx, l.account)
+	l.p.Write(ctx, "Your account has been created. What will your first character be known as?")
+	return l.state.SetState("NEW_CHARACTER")
+}
+
+// showMenu lists the characters on the account and what can be done with
+// them.
+func (l *Login) showMenu(ctx context.Context) error {
+	l.p.Buffer(ctx, "\nAccount: {W%s{x\n\n", l.account.GetName())
+	characters := l.account.Characters()
+	if len(characters) == 0 {
+		l.p.Buffer(ctx, "You have no characters yet.\n")
+	}
+	for n, c := range characters {
+		l.p.Buffer(ctx, "  %d) %s\n", n+1, c.Name)
+	}
+	l.p.Buffer(ctx, "\nType a character's name or number to play, {Wnew{x to create a character, {Wdelete <name>{x to delete one, or {Wquit{x to leave.")
+	l.p.Flush(ctx)
+	return l.state.SetState("ACCOUNT_MENU")
+}
+
+// AccountMenu step.
+func (l *Login) AccountMenu(ctx context.Context, text string) error {
+	args := strings.Fields(text)
+	if len(args) == 0 {
+		return l.showMenu(ctx)
+	}
+	switch strings.ToLower(args[0]) {
+	case "new":
+		if max := config.GetInt("account_max_characters"); len(l.account.Characters()) >= max {
+			l.p.Write(ctx, "You already have %d characters, delete one first.", max)
+			return nil
+		}
+		l.p.Write(ctx, "What will your new character be known as?")
+		return l.state.SetState("NEW_CHARACTER")
+	case "delete":
+		var c *accountCharacter
+		if len(args) > 1 {
+			c = l.account.Character(args[1])
+		}
+		if c == nil {
+			l.p.Write(ctx, "Which of your characters do you want to delete?")
+			return nil
+		}
+		l.pending = c.Name
+		l.p.Write(ctx, "{RThis will delete %s forever.{x Type their name again to confirm: ", c.Name)
+		return l.state.SetState("CONFIRM_DELETE")
+	case "quit":
+		l.disconnect(ctx, "See ya!\n")
+		return nil
+	}
+
+	c := l.account.Character(text)
+	if c == nil {
+		l.p.Write(ctx, "You have no character by that name.")
+		return nil
+	}
+	return l.play(ctx, c)
+}
+
+// NewCharacter step.
+func (l *Login) NewCharacter(ctx context.Context, text string) error {
+	if text == "" {
+		return l.showMenu(ctx)
+	}
+	if err := l.ValidateName(text); err != nil {
+		l.p.Write(ctx, "%s\n", err)
+		l.p.Write(ctx, "So then, what will your character be known as?")
+		return nil
+	}
+	if characterExists(text) {
+		l.p.Write(ctx, "That name is already taken, what else will your character be known as?")
+		return nil
+	}
+	l.pending = normalizeName(text)
+	l.p.Write(ctx, "Are you sure you want to be known as %s?", l.pending)
+	return l.state.SetState("CONFIRM_CHARACTER")
+}
+
+// ConfirmCharacter step, which moves on to choosing a race.
+func (l *Login) ConfirmCharacter(ctx context.Context, text string) error {
+	if text != "yes" && text != "y" {
+		l.p.Write(ctx, "Okay, so what will your character be known as?")
+		return l.state.SetState("NEW_CHARACTER")
+	}
+	return l.showRaces(ctx)
+}
+
+// showRaces lists the races to choose from.
+func (l *Login) showRaces(ctx context.Context) error {
+	l.p.Buffer(ctx, "\nChoose a race for %s:\n\n", l.pending)
+	for n, r := range getCreationTables().Races {
+		l.p.Buffer(ctx, "  %d) {W%-10s{x %s\n", n+1, r.Name, r.Description)
+	}
+	l.p.Buffer(ctx, "\nType a race's name or number, or {Wback{x to choose another name.")
+	l.p.Flush(ctx)
+	return l.state.SetState("CHOOSE_RACE")
+}
+
+// ChooseRace step.
+func (l *Login) ChooseRace(ctx context.Context, text string) error {
+	if strings.EqualFold(text, "back") {
+		l.p.Write(ctx, "So then, what will your character be known as?")
+		return l.state.SetState("NEW_CHARACTER")
+	}
+	r := findRace(text)
+	if r == nil {
+		return l.showRaces(ctx)
+	}
+	l.race = r
+	return l.showClasses(ctx)
+}
+
+// showClasses lists the classes to choose from.
+func (l *Login) showClasses(ctx context.Context) error {
+	l.p.Buffer(ctx, "\nChoose a class for %s the %s:\n\n", l.pending, l.race.Name)
+	for n, c := range getCreationTables().Classes {
+		l.p.Buffer(ctx, "  %d) {W%-10s{x %s\n", n+1, c.Name, c.Description)
+	}
+	l.p.Buffer(ctx, "\nType a class's name or number, or {Wback{x to choose another race.")
+	l.p.Flush(ctx)
+	return l.state.SetState("CHOOSE_CLASS")
+}
+
+// ChooseClass step.
+func (l *Login) ChooseClass(ctx context.Context, text string) error {
+	if strings.EqualFold(text, "back") {
+		return l.showRaces(ctx)
+	}
+	c := findClass(text)
+	if c == nil {
+		return l.showClasses(ctx)
+	}
+	l.class = c
+	return l.showAttributeMethods(ctx)
+}
+
+// showAttributeMethods asks how the character's attributes will be chosen.
+func (l *Login) showAttributeMethods(ctx context.Context) error {
+	l.p.Write(ctx, "\nWould you like to {Wroll{x your attributes, or {Wbuy{x them with %d points? Type {Wback{x to choose another class.", attributePoints)
+	return l.state.SetState("CHOOSE_ATTRIBUTES")
+}
+
+// ChooseAttributes step.
+func (l *Login) ChooseAttributes(ctx context.Context, text string) error {
+	switch strings.ToLower(text) {
+	case "back":
+		return l.showClasses(ctx)
+	case "roll":
+		l.attributes = rollAttributes()
+		return l.showRoll(ctx)
+	case "buy":
+		l.attributes = baseAttributes()
+		return l.showBuy(ctx)
+	}
+	return l.showAttributeMethods(ctx)
+}
+
+// showRoll shows the attributes just rolled.
+func (l *Login) showRoll(ctx context.Context) error {
+	l.p.Write(ctx, "\nYou rolled: %s\n\nType {Wkeep{x to keep these, {Wroll{x to roll again, or {Wback{x to choose another way.", l.attributes)
+	return l.state.SetState("ROLL_ATTRIBUTES")
+}
+
+// RollAttributes step.
+func (l *Login) RollAttributes(ctx context.Context, text string) error {
+	switch strings.ToLower(text) {
+	case "back":
+		return l.showAttributeMethods(ctx)
+	case "keep":
+		return l.showSummary(ctx)
+	}
+	l.attributes = rollAttributes()
+	return l.showRoll(ctx)
+}
+
+// showBuy shows the attributes bought so far and the points left to spend.
+func (l *Login) showBuy(ctx context.Context) error {
+	l.p.Write(ctx, "\nAttributes: %s\nYou have %d points left to spend. Each attribute starts at %d and may be raised to %d.\n\nType {W<attribute> <value>{x to set one, {Wreset{x to start over, {Wdone{x when finished, or {Wback{x to choose another way.",
+		l.attributes, attributePoints-l.attributes.pointsSpent(), attributeBase, attributeMax)
+	return l.state.SetState("BUY_ATTRIBUTES")
+}
+
+// BuyAttributes step.
+func (l *Login) BuyAttributes(ctx context.Context, text string) error {
+	args := strings.Fields(strings.ToLower(text))
+	if len(args) == 1 {
+		switch args[0] {
+		case "back":
+			return l.showAttributeMethods(ctx)
+		case "reset":
+			l.attributes = baseAttributes()
+			return l.showBuy(ctx)
+		case "done":
+			if left := attributePoints - l.attributes.pointsSpent(); left > 0 {
+				l.p.Write(ctx, "You still have %d points to spend.", left)
+				return nil
+			}
+			return l.showSummary(ctx)
+		}
+	}
+	if len(args) != 2 || !isAttribute(args[0]) {
+		return l.showBuy(ctx)
+	}
+	value, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || value < attributeBase || value > attributeMax {
+		l.p.Write(ctx, "Attributes must be between %d and %d.", attributeBase, attributeMax)
+		return nil
+	}
+	bought := *l.attributes
+	bought.set(args[0], value)
+	if bought.pointsSpent() > attributePoints {
+		l.p.Write(ctx, "You don't have enough points for that.")
+		return nil
+	}
+	l.attributes = &bought
+	return l.showBuy(ctx)
+}
+
+// showSummary shows the character about to be created, for a final
+// confirmation.
+func (l *Login) showSummary(ctx context.Context) error {
+	final := l.attributes.withRace(l.race)
+	stats := startingStats(l.class, final)
+	l.p.Write(ctx, "\n{W%s{x the %s %s\nAttributes: %s\nHealth %d  Mana %d  Move %d\n\nCreate this character? Type {Wyes{x to enter the world, or {Wback{x to change your attributes.",
+		l.pending, l.race.Name, l.class.Name, final, stats.MaxHealth, stats.MaxMana, stats.MaxMove)
+	return l.state.SetState("CONFIRM_CREATION")
+}
+
+// ConfirmCreation step, which creates the character and enters the world.
+func (l *Login) ConfirmCreation(ctx context.Context, text string) error {
+	switch strings.ToLower(text) {
+	case "back":
+		return l.showAttributeMethods(ctx)
+	case "yes", "y":
+	default:
+		return l.showSummary(ctx)
+	}
+	if l.refuseShutdown(ctx) {
+		return nil
+	}
+	// Someone may have taken the name while we were deciding.
+	if characterExists(l.pending) {
+		l.p.Write(ctx, "That name was just taken, what else will your character be known as?")
+		return l.state.SetState("NEW_CHARACTER")
+	}
+
+	final := l.attributes.withRace(l.race)
+	l.p.SetName(ctx, l.pending)
+	l.p.lock.Lock(ctx)
+	l.p.Data.Account = l.account.GetUUID()
+	l.p.Data.Race = l.race.Name
+	l.p.Data.Class = l.class.Name
+	l.p.Data.Attributes = final
+	l.p.Data.Stats = startingStats(l.class, final)
+	l.p.lock.Unlock(ctx)
+	// The account is saved first, so the character is never left without
+	// one. A character on the account that failed to save is taken off it
+	// again, so the name can be used.
+	l.account.AddCharacter(l.p.GetUUID(ctx), l.pending)
+	if err := l.account.Save(); err != nil {
+		l.account.RemoveCharacter(l.pending)
+		l.disconnect(ctx, "Something went wrong saving your account, contact an admin.")
+		return err
+	}
+	if err := l.p.Save(ctx); err != nil {
+		l.account.RemoveCharacter(l.pending)
+		if err := l.account.Save(); err != nil {
+			log.Error().Err(err).Str("account", l.account.GetName()).Msg("Unable to take unsaved character off account.")
+		}
+		l.disconnect(ctx, "Something went wrong creating your character, contact an admin.")
+		return err
+	}
+	log.Info().
+		Str("account", l.account.GetName()).
+		Str("player", l.pending).
+		Str("race", l.race.Name).
+		Str("class", l.class.Name).
+		Msg("Character created.")
+	l.applyAccountFlags(ctx)
+
 	l.p.Write(ctx, "Entering the world!")
 	l.p.Game(ctx)
 	Atlas.AddPlayer(ctx, l.p)
-	l.p.ToRoom(ctx, Atlas.GetRoom(0, 0, 0))
+	l.p.ToRoom(ctx, l.startRoom())
 	l.p.GetRoom(ctx).AllPlayers(ctx, func(uuid string, p *Player) {
 		if p == l.p {
 			return
 		}
 		p.Write(ctx, "%s enters the realm before your eyes.", l.p.GetName(ctx))
 	})
-	l.p.Command("look")
-	return nil
+	// Look right away, rather than queueing the command, so that it can't
+	// land after whatever the player types next.
+	return l.p.gameInterp.DoLook(ctx)
+}
+
+// startRoom returns the room a new character of the chosen race begins in,
+// falling back to the center of the world.
+func (l *Login) startRoom() *Room {
+	if start := l.race.Start; start != nil {
+		if room := Atlas.GetRoom(start[0], start[1], start[2]); room != nil {
+			return room
+		}
+		log.Warn().Str("race", l.race.Name).Msg("Race start room does not exist, using the default.")
+	}
+	return Atlas.GetRoom(0, 0, 0)
+}
+
+// ConfirmDelete step.
+func (l *Login) ConfirmDelete(ctx context.Context, text string) error {
+	name := l.pending
+	l.pending = ""
+	if !strings.EqualFold(text, name) {
+		l.p.Write(ctx, "%s was not deleted.", name)
+		return l.showMenu(ctx)
+	}
+	if Atlas.GetPlayer(name) != nil {
+		l.p.Write(ctx, "%s is in the world right now and can't be deleted.", name)
+		return l.showMenu(ctx)
+	}
+
+	l.account.RemoveCharacter(name)
+	if err := l.account.Save(); err != nil {
+		l.disconnect(ctx, "Something went wrong saving your account, contact an admin.")
+		return err
+	}
+	if err := deleteCharacter(name); err != nil {
+		log.Error().Err(err).Str("player", name).Msg("Unable to delete pfile.")
+	}
+	log.Info().Str("account", l.account.GetName()).Str("player", name).Msg("Character deleted.")
+	l.p.Write(ctx, "%s has been deleted.", name)
+	return l.showMenu(ctx)
+}
+
+// applyAccountFlags copies the account wide settings onto the character.
+func (l *Login) applyAccountFlags(ctx context.Context) {
+	for key, on := range l.account.Flags() {
+		if on {
+			l.p.EnableFlag(ctx, key)
+		} else {
+			l.p.DisableFlag(ctx, key)
+		}
+	}
+}
+
+// play loads a character from the account and enters the world with them.
+func (l *Login) play(ctx context.Context, c *accountCharacter) error {
+	if l.refuseShutdown(ctx) || l.refuseBan(ctx, c.Name) {
+		return nil
+	}
+	l.p.SetName(ctx, c.Name)
+	loaded, err := l.p.Load(ctx)
+	if err != nil {
+		l.disconnect(ctx, pfileProblem(err))
+		return err
+	}
+	if !loaded {
+		// A pfile that was quarantined on an earlier login is still on
+		// the account.
+		if found, _ := quarantined(storage.Players, playerKey(c.Name)); found {
+			l.disconnect(ctx, pfileProblem(ErrCorrupt))
+			return nil
+		}
+		l.disconnect(ctx, "Something went wrong trying to load your pfile, contact an admin.")
+		return nil
+	}
+	if l.p.GetData(ctx).Account != l.account.GetUUID() {
+		log.Error().Str("account", l.account.GetName()).Str("player", c.Name).Msg("Character belongs to another account.")
+		l.disconnect(ctx, "Something went wrong trying to load your pfile, contact an admin.")
+		return nil
+	}
+	l.applyAccountFlags(ctx)
+	// Logging in is a checkpoint a character can be restored to, as the
+	// autosave doesn't take backups.
+	if err := backupPlayer(c.Name); err != nil {
+		log.Error().Err(err).Str("player", c.Name).Msg("Unable to back up player.")
+	}
+
+	// TODO(lobato): Add player to room before we atlas add player, make this atlas.getplayer and add only after room is not nil
+	if existingPlayer := Atlas.AddPlayer(ctx, l.p); existingPlayer != nil {
+		// The character is already in the world, either link dead or
+		// connected somewhere else. Move this connection over to them and
+		// let this login go.
+		l.p.Write(ctx, "Reconnecting to your character.")
+		existingPlayer.takeOver(ctx, l.p)
+		l.p.cancel()
+		existingPlayer.applyCompression(ctx)
+		existingPlayer.Command("look")
+		return nil
+	}
+
+	l.p.applyCompression(ctx)
+	l.p.Write(ctx, "Entering the world!")
+	if target := Atlas.GetRoomByUUID(l.p.Data.Room); target != nil {
+		l.p.ToRoom(ctx, target)
+	} else {
+		l.p.ToRoom(ctx, Atlas.GetRoom(0, 0, 0))
+	}
+
+	l.p.Game(ctx)
+	l.p.GetRoom(ctx).AllPlayers(ctx, func(uuid string, p *Player) {
+		if p == l.p {
+			return
+		}
+		p.Write(ctx, "%s enters the realm before your eyes.", l.p.GetName(ctx))
+	})
+
+	return l.p.gameInterp.DoLook(ctx)
 }
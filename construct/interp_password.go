@@ -0,0 +1,117 @@
+package construct
+
+import (
+	"context"
+
+	"github.com/Cidan/gomud/state"
+	"github.com/rs/zerolog/log"
+)
+
+// PasswordInterp walks a player through changing the password of their
+// account. An empty line at any step cancels the change.
+type PasswordInterp struct {
+	p        *Player
+	state    *state.State
+	previous Interp
+	pending  string
+}
+
+// NewPasswordInterp creates a new password change interp.
+func NewPasswordInterp(p *Player) *PasswordInterp {
+	i := &PasswordInterp{p: p}
+
+	s := state.New("OLD_PASSWORD")
+	s.
+		Add(&state.Event{
+			Name: "OLD_PASSWORD",
+			Fn:   i.OldPassword,
+		}).
+		Add(&state.Event{
+			Name: "NEW_PASSWORD",
+			Fn:   i.NewPassword,
+		}).
+		Add(&state.Event{
+			Name: "CONFIRM_PASSWORD",
+			Fn:   i.ConfirmPassword,
+		})
+	i.state = s
+	return i
+}
+
+func (i *PasswordInterp) Read(ctx context.Context, text string) error {
+	if text == "" {
+		i.p.Write(ctx, "Password change cancelled.")
+		i.finish(ctx)
+		return nil
+	}
+	return i.state.Process(ctx, text)
+}
+
+// Start switches the player to the password interp and asks for their
+// current password. The player is returned to the interp they came from
+// when the change is done.
+func (i *PasswordInterp) Start(ctx context.Context) error {
+	i.p.lock.Lock(ctx)
+	i.previous = i.p.currentInterp
+	i.p.lock.Unlock(ctx)
+	i.pending = ""
+	i.p.setInterp(ctx, i)
+	i.p.SetEcho(ctx, false)
+	i.p.Write(ctx, "Old password (blank line to cancel): ")
+	return i.state.SetState("OLD_PASSWORD")
+}
+
+// finish returns the player to the interp they came from.
+func (i *PasswordInterp) finish(ctx context.Context) {
+	i.pending = ""
+	i.p.SetEcho(ctx, true)
+	i.p.setInterp(ctx, i.previous)
+}
+
+// OldPassword step.
+func (i *PasswordInterp) OldPassword(ctx context.Context, text string) error {
+	if account := i.p.GetAccount(ctx); account == nil || !account.IsPassword(text) {
+		log.Info().Str("player", i.p.GetName(ctx)).Msg("Wrong password on password change.")
+		i.p.Write(ctx, "Wrong password.")
+		i.finish(ctx)
+		return nil
+	}
+	i.p.Write(ctx, "New password: ")
+	return i.state.SetState("NEW_PASSWORD")
+}
+
+// NewPassword step.
+func (i *PasswordInterp) NewPassword(ctx context.Context, text string) error {
+	err := validatePassword(i.p.GetAccount(ctx).GetName(), text)
+	if err == nil {
+		err = validatePassword(i.p.GetName(ctx), text)
+	}
+	if err != nil {
+		i.p.Write(ctx, "%s\nNew password: ", err)
+		return nil
+	}
+	i.pending = hashPassword(text)
+	i.p.Write(ctx, "Confirm your new password and type it again: ")
+	return i.state.SetState("CONFIRM_PASSWORD")
+}
+
+// ConfirmPassword step.
+func (i *PasswordInterp) ConfirmPassword(ctx context.Context, text string) error {
+	if !checkPassword(i.pending, text) {
+		i.p.Write(ctx, "Passwords do not match.\nNew password: ")
+		return i.state.SetState("NEW_PASSWORD")
+	}
+	account := i.p.GetAccount(ctx)
+	account.mutex.Lock()
+	account.Data.Password = i.pending
+	account.mutex.Unlock()
+	if err := account.Save(); err != nil {
+		i.p.Write(ctx, "Something went wrong saving your new password, contact an admin.")
+		i.finish(ctx)
+		return err
+	}
+	log.Info().Str("account", account.GetName()).Str("player", i.p.GetName(ctx)).Msg("Password changed.")
+	i.p.Write(ctx, "{GYour password has been changed.{x")
+	i.finish(ctx)
+	return nil
+}
@@ -26,7 +26,7 @@ func NewTextInterp(p *Player) *TextInterp {
 	e := &TextInterp{
 		p: p,
 	}
-	commands := newCommands()
+	commands := newCommands(p)
 	commands.Add(&command{
 		name: `:w`,
 		Fn:   e.DoDone,
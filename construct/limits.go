@@ -0,0 +1,78 @@
+package construct
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/limit"
+	"github.com/rs/zerolog/log"
+)
+
+// loginLimits slow down password guessing, both from a single address and
+// against a single account.
+var loginLimits struct {
+	mutex   sync.Mutex
+	address *limit.Backoff
+	account *limit.Backoff
+}
+
+// loginBackoff returns the login failure trackers for addresses and
+// accounts, created from config on first use.
+func loginBackoff() (*limit.Backoff, *limit.Backoff) {
+	loginLimits.mutex.Lock()
+	defer loginLimits.mutex.Unlock()
+	if loginLimits.address == nil {
+		newBackoff := func() *limit.Backoff {
+			return limit.NewBackoff(
+				config.GetDuration("login_backoff_base"),
+				config.GetDuration("login_backoff_max"),
+				config.GetInt("login_lockout_failures"),
+				config.GetDuration("login_lockout_duration"),
+				config.GetDuration("login_failure_reset"),
+			)
+		}
+		loginLimits.address = newBackoff()
+		loginLimits.account = newBackoff()
+	}
+	return loginLimits.address, loginLimits.account
+}
+
+// LoginWait returns how long the given address must wait before it may try
+// to log in again, or zero if it may try now.
+func LoginWait(address string) time.Duration {
+	addresses, _ := loginBackoff()
+	return addresses.Wait(address)
+}
+
+// loginWait returns how long the player must wait before trying the
+// password for the given account.
+func (p *Player) loginWait(ctx context.Context, account string) time.Duration {
+	addresses, accounts := loginBackoff()
+	wait := addresses.Wait(p.GetAddress(ctx))
+	if w := accounts.Wait(account); w > wait {
+		wait = w
+	}
+	return wait
+}
+
+// loginFailed records a failed login for the player's address and the
+// account they tried.
+func (p *Player) loginFailed(ctx context.Context, account string) {
+	addresses, accounts := loginBackoff()
+	address := p.GetAddress(ctx)
+	if wait, locked := addresses.Fail(address); locked {
+		log.Warn().Str("address", address).Dur("lockout", wait).Msg("Address locked out after repeated login failures.")
+	}
+	if wait, locked := accounts.Fail(account); locked {
+		log.Warn().Str("account", account).Str("address", address).Dur("lockout", wait).Msg("Account locked out after repeated login failures.")
+	}
+}
+
+// loginSucceeded clears the failures against an account after a good
+// login.
+func (p *Player) loginSucceeded(ctx context.Context, account string) {
+	_, accounts := loginBackoff()
+	accounts.Reset(account)
+}
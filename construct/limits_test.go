@@ -0,0 +1,54 @@
+package construct
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// testResetLoginLimits recreates the login failure trackers from config, and
+// again once the test is done so that other tests sharing the pipe address
+// aren't held back.
+func testResetLoginLimits(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		loginLimits.mutex.Lock()
+		defer loginLimits.mutex.Unlock()
+		loginLimits.address = nil
+		loginLimits.account = nil
+	}
+	reset()
+	t.Cleanup(func() {
+		config.Set("login_backoff_base", "2s")
+		reset()
+	})
+}
+
+func TestLoginBackoff(t *testing.T) {
+	testSetupWorld(t)
+	config.Set("login_backoff_base", "100ms")
+	testResetLoginLimits(t)
+
+	a := NewAccount("Guarded")
+	a.SetPassword(testPassword)
+	assert.NoError(t, a.Save())
+
+	_, w := testConnect(t)
+	runCommands(t, nil, w, []string{"Guarded", "not the password"})
+	_, accounts := loginBackoff()
+	assert.Eventually(t, func() bool {
+		return accounts.Wait(a.GetUUID()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Greater(t, LoginWait("pipe"), time.Duration(0))
+
+	// Once the wait is over the right password gets in, and clears the
+	// failures against the account.
+	time.Sleep(accounts.Wait(a.GetUUID()))
+	_, w = testConnect(t)
+	runCommands(t, nil, w, []string{"Guarded", testPassword})
+	assert.Eventually(t, func() bool {
+		return accounts.Wait(a.GetUUID()) == 0 && LoginWait("pipe") == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,173 @@
+package construct
+
+import (
+	"bufio"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/telnet"
+	"github.com/rs/zerolog/log"
+)
+
+// link is a player's connection and the lines read from it. A link is not
+// tied to a player, so that it can be handed to another player when a
+// character is taken over by a new login.
+type link struct {
+	conn      *telnet.Conn
+	lines     chan string
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newLink starts reading lines from a connection. The lines channel is
+// closed once the connection drops or the link is closed.
+func newLink(c *telnet.Conn) *link {
+	l := &link{
+		conn:   c,
+		lines:  make(chan string),
+		closed: make(chan struct{}),
+	}
+	go func() {
+		defer close(l.lines)
+		s := bufio.NewScanner(c)
+		for s.Scan() {
+			select {
+			case l.lines <- s.Text():
+			case <-l.closed:
+				return
+			}
+		}
+	}()
+	return l
+}
+
+// close closes the connection, which stops the link reading.
+func (l *link) close() {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		l.conn.Close()
+	})
+}
+
+// getLink returns the player's current link, or nil if they have none.
+func (p *Player) getLink(ctx context.Context) *link {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	return p.link
+}
+
+// IsLinkdead returns true if the player lost their connection while in the
+// world, and is waiting for a reconnect.
+func (p *Player) IsLinkdead(ctx context.Context) bool {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	return p.linkdead
+}
+
+// relink wakes up the interp loop so that it reads from a new link.
+func (p *Player) relink() {
+	select {
+	case p.relinked <- struct{}{}:
+	default:
+	}
+}
+
+// linkLost handles a dropped link. Players in the world are left there link
+// dead, waiting for a reconnect, anyone else is simply dropped.
+func (p *Player) linkLost(ctx context.Context, l *link) {
+	p.lock.Lock(ctx)
+	if p.link != l {
+		// The link was already replaced by a reconnect.
+		p.lock.Unlock(ctx)
+		return
+	}
+	p.link = nil
+	p.connection = nil
+	inWorld := p.inRoom != nil && p.currentInterp != p.loginInterp
+	if inWorld {
+		p.linkdead = true
+		p.linkdeadSince = time.Now()
+	}
+	p.lock.Unlock(ctx)
+	l.close()
+
+	if !inWorld {
+		p.cancel()
+		return
+	}
+	log.Info().Str("player", p.GetName(ctx)).Msg("Player has lost their link.")
+	if room := p.GetRoom(ctx); room != nil {
+		room.AllPlayers(ctx, func(uuid string, rp *Player) {
+			if rp == p {
+				return
+			}
+			rp.Write(ctx, "%s has lost their link.", p.GetName(ctx))
+		})
+	}
+}
+
+// checkLinkdead saves and removes a link dead player once they have been
+// gone for longer than the linkdead_timeout config key.
+func (p *Player) checkLinkdead(ctx context.Context) {
+	p.lock.Lock(ctx)
+	expired := p.linkdead && time.Since(p.linkdeadSince) >= config.GetDuration("linkdead_timeout")
+	p.lock.Unlock(ctx)
+	if !expired {
+		return
+	}
+	log.Info().Str("player", p.GetName(ctx)).Msg("Removing link dead player.")
+	room := p.GetRoom(ctx)
+	p.Stop(ctx)
+	if room == nil {
+		return
+	}
+	room.AllPlayers(ctx, func(uuid string, rp *Player) {
+		rp.Write(ctx, "%s fades out of existence.", p.GetName(ctx))
+	})
+}
+
+// takeOver moves the connection of a player that just logged in onto this
+// player, which is already in the world. Any connection this player still
+// has is closed, and the player is no longer link dead.
+func (p *Player) takeOver(ctx context.Context, from *Player) {
+	from.lock.Lock(ctx)
+	l := from.link
+	secure, address, supports := from.secure, from.address, from.gmcpSupports
+	from.link = nil
+	from.connection = nil
+	from.lock.Unlock(ctx)
+
+	p.lock.Lock(ctx)
+	old := p.link
+	wasLinkdead := p.linkdead
+	p.link = l
+	p.connection = l.conn
+	p.secure = secure
+	p.address = address
+	p.gmcpSupports = supports
+	p.linkdead = false
+	p.lastActionTime = time.Now()
+	p.lock.Unlock(ctx)
+	l.conn.HandleSubnegotiation(telnet.OptGMCP, p.handleGMCP)
+
+	if old != nil {
+		old.conn.Write([]byte("\r\nYou have logged in from somewhere else, goodbye.\r\n"))
+		old.close()
+	}
+	p.relink()
+
+	log.Info().Str("player", p.GetName(ctx)).Bool("linkdead", wasLinkdead).Msg("Player reconnected.")
+	if !wasLinkdead {
+		return
+	}
+	if room := p.GetRoom(ctx); room != nil {
+		room.AllPlayers(ctx, func(uuid string, rp *Player) {
+			if rp == p {
+				return
+			}
+			rp.Write(ctx, "%s has reconnected.", p.GetName(ctx))
+		})
+	}
+}
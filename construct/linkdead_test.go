@@ -0,0 +1,135 @@
+package construct
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/lock"
+	"github.com/stretchr/testify/assert"
+)
+
+// testLoginDroppable creates a new character like testLoginNewUser, and
+// returns the client side of the connection so that it can be dropped.
+func testLoginDroppable(t *testing.T, name string) net.Conn {
+	t.Helper()
+	client, server := net.Pipe()
+	p := NewPlayer()
+	ctx := lock.Context(p.Context(), p.Data.UUID+"incomming_conn")
+	p.SetConnection(ctx, server)
+	go p.Start()
+
+	reader := bufio.NewReader(client)
+	go func() {
+		for {
+			if _, err := reader.ReadString('\xf9'); err != nil {
+				return
+			}
+		}
+	}()
+	runCommands(t, nil, bufio.NewWriter(client), append([]string{
+		name, "yes", testPassword, testPassword, name, "yes",
+	}, testCreation...))
+	return client
+}
+
+func TestLinkdeadReconnect(t *testing.T) {
+	testSetupWorld(t)
+	client := testLoginDroppable(t, "Dropper")
+	p := testFindPlayer(t, "Dropper")
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+	assert.Eventually(t, func() bool {
+		return p.GetRoom(ctx) != nil
+	}, time.Second*5, time.Millisecond*10)
+	room := p.GetRoom(ctx)
+
+	client.Close()
+	assert.Eventually(t, func() bool {
+		return p.IsLinkdead(ctx)
+	}, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, p, Atlas.GetPlayer("Dropper"))
+	assert.Equal(t, room, p.GetRoom(ctx))
+	assert.Equal(t, "Dropper is here. (linkdead)", p.PlayerDescription(ctx))
+
+	// Logging back in picks up the same player, and input flows from the
+	// new connection.
+	_, w := testLoginUser(t, "Dropper")
+	assert.Eventually(t, func() bool {
+		return !p.IsLinkdead(ctx)
+	}, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, p, Atlas.GetPlayer("Dropper"))
+	assert.True(t, p.Flag(ctx, "prompt"))
+	runCommands(t, nil, w, []string{"prompt"})
+	assert.Eventually(t, func() bool {
+		return !p.Flag(ctx, "prompt")
+	}, time.Second*5, time.Millisecond*10)
+	runCommands(t, nil, w, []string{"quit"})
+}
+
+func TestLinkdeadTimeout(t *testing.T) {
+	testSetupWorld(t)
+	config.Set("linkdead_timeout", "1s")
+	t.Cleanup(func() {
+		config.Set("linkdead_timeout", "5m")
+	})
+	client := testLoginDroppable(t, "Vanisher")
+	p := testFindPlayer(t, "Vanisher")
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+	assert.Eventually(t, func() bool {
+		return p.GetRoom(ctx) != nil
+	}, time.Second*5, time.Millisecond*10)
+
+	client.Close()
+	assert.Eventually(t, func() bool {
+		return Atlas.GetPlayer("Vanisher") == nil
+	}, time.Second*5, time.Millisecond*10)
+	assert.Error(t, p.Context().Err())
+	assert.True(t, characterExists("Vanisher"))
+}
+
+func TestWriteDuringTakeOver(t *testing.T) {
+	testSetupWorld(t)
+	client := testLoginDroppable(t, "Chatter")
+	defer client.Close()
+	p := testFindPlayer(t, "Chatter")
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+	assert.Eventually(t, func() bool {
+		return p.IsInGame(ctx)
+	}, time.Second*5, time.Millisecond*10)
+
+	// Other players write to the player from their own goroutines, while
+	// reconnects swap the connection out from under them.
+	stop, done := make(chan struct{}), make(chan struct{})
+	var writes int32
+	go func() {
+		defer close(done)
+		wctx := lock.Context(p.Context(), p.Data.UUID+"writer")
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				p.Write(wctx, "Hello.")
+				atomic.AddInt32(&writes, 1)
+				runtime.Gosched()
+			}
+		}
+	}()
+	for atomic.LoadInt32(&writes) < 100 {
+		c, server := net.Pipe()
+		go io.Copy(ioutil.Discard, c)
+		from := NewPlayer()
+		fctx := lock.Context(from.Context(), from.Data.UUID+"test")
+		from.SetConnection(fctx, server)
+		p.takeOver(ctx, from)
+	}
+	close(stop)
+	<-done
+	p.Stop(ctx)
+}
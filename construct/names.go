@@ -0,0 +1,222 @@
+package construct
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// nameKey returns the key a name is known by, so that case variants of a
+// name are all the same account or character.
+func nameKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// normalizeName returns a name as it is shown in game, with only the first
+// letter capitalized.
+func normalizeName(name string) string {
+	if name == "" {
+		return name
+	}
+	name = strings.ToLower(name)
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// validNameFormat returns an error if the name can never be a name. The
+// error is suitable for showing to the player.
+func validNameFormat(name string) error {
+	if len(name) > 16 || !RegexValidName(name) || strings.Count(name, `'`) > 1 {
+		return errors.New("That is an invalid name. Your name may contain only a-zA-Z and a single apostophe, and must be less than 16 letters long.")
+	}
+	return nil
+}
+
+// forbiddenNames are patterns for names nobody may take, on top of any
+// listed in the file named by the forbidden_names_file config key. They
+// keep out profanity and names that pretend to be staff.
+var forbiddenNames = compileNamePatterns([]string{
+	// Staff impersonation.
+	`^admin`, `^administrator$`, `^imm(ortal)?$`, `^implementor$`, `^god(dess)?$`,
+	`^staff`, `^moderator$`, `^sysop$`, `^owner$`, `^gm$`, `^system$`,
+	// Profanity.
+	`fuck`, `shit`, `cunt`, `nigg`, `fagg`, `whore`, `bitch`, `slut`, `twat`, `wank`,
+})
+
+// compileNamePatterns compiles case insensitive name patterns, logging and
+// skipping any that don't compile.
+func compileNamePatterns(patterns []string) []*regexp.Regexp {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			log.Error().Err(err).Str("pattern", pattern).Msg("Invalid forbidden name pattern.")
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled
+}
+
+// isForbiddenName returns true if the name matches a forbidden pattern. The
+// forbidden names file holds one pattern per line, and lines starting with
+// # are comments.
+func isForbiddenName(name string) bool {
+	for _, re := range forbiddenNames {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	path := config.GetString("forbidden_names_file")
+	if path == "" {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Error().Err(err).Str("path", path).Msg("Unable to read forbidden names file.")
+		return false
+	}
+	defer f.Close()
+	var patterns []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	for _, re := range compileNamePatterns(patterns) {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// reservation holds a name so that nobody can take it, or so that only the
+// account it is held for can.
+type reservation struct {
+	Name    string
+	For     string
+	By      string
+	Created time.Time
+}
+
+// reservations are the reserved names, saved to a single file.
+var reservations = struct {
+	mutex sync.RWMutex
+	names map[string]*reservation
+}{names: make(map[string]*reservation)}
+
+// LoadReservedNames reads the reserved names from storage. Having none
+// saved is not an error.
+func LoadReservedNames() error {
+	data, err := loadRecord(storage.Game, "reserved_names")
+	if errors.Is(err, storage.ErrNotFound) {
+		data = []byte("[]")
+	} else if err != nil {
+		return err
+	}
+	var list []*reservation
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	names := make(map[string]*reservation, len(list))
+	for _, r := range list {
+		names[nameKey(r.Name)] = r
+	}
+	reservations.mutex.Lock()
+	defer reservations.mutex.Unlock()
+	reservations.names = names
+	return nil
+}
+
+// saveReservedNames writes the reserved names to storage. Must be called with
+// the mutex held.
+func saveReservedNames() error {
+	data, err := json.Marshal(listReservedNamesLocked())
+	if err != nil {
+		return err
+	}
+	return saveRecord(storage.Game, "reserved_names", data)
+}
+
+// listReservedNamesLocked returns the reserved names in the order they were
+// reserved. Must be called with the mutex held.
+func listReservedNamesLocked() []*reservation {
+	list := make([]*reservation, 0, len(reservations.names))
+	for _, r := range reservations.names {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Created.Equal(list[j].Created) {
+			return list[i].Created.Before(list[j].Created)
+		}
+		return nameKey(list[i].Name) < nameKey(list[j].Name)
+	})
+	return list
+}
+
+// listReservedNames returns every reserved name.
+func listReservedNames() []*reservation {
+	reservations.mutex.RLock()
+	defer reservations.mutex.RUnlock()
+	return listReservedNamesLocked()
+}
+
+// reserveName reserves a name, replacing any earlier reservation of it, and
+// saves the reserved names.
+func reserveName(r *reservation) error {
+	reservations.mutex.Lock()
+	defer reservations.mutex.Unlock()
+	reservations.names[nameKey(r.Name)] = r
+	return saveReservedNames()
+}
+
+// unreserveName removes the reservation of a name and saves the reserved
+// names. Returns the reservation removed, or nil if the name wasn't reserved.
+func unreserveName(name string) (*reservation, error) {
+	reservations.mutex.Lock()
+	defer reservations.mutex.Unlock()
+	r, ok := reservations.names[nameKey(name)]
+	if !ok {
+		return nil, nil
+	}
+	delete(reservations.names, nameKey(name))
+	return r, saveReservedNames()
+}
+
+// reservedName returns the reservation of a name, or nil if it isn't
+// reserved.
+func reservedName(name string) *reservation {
+	reservations.mutex.RLock()
+	defer reservations.mutex.RUnlock()
+	return reservations.names[nameKey(name)]
+}
+
+// checkNewName returns an error if a new account or character may not take
+// the name. Reserved names may only be taken by the account they are held
+// for. The error is suitable for showing to the player.
+func checkNewName(name, account string) error {
+	if err := validNameFormat(name); err != nil {
+		return err
+	}
+	if isForbiddenName(name) || nameBan(name) != nil {
+		return errors.New("That name is not allowed.")
+	}
+	if r := reservedName(name); r != nil {
+		if r.For == "" || nameKey(r.For) != nameKey(account) {
+			return errors.New("That name is reserved.")
+		}
+	}
+	return nil
+}
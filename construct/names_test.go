@@ -0,0 +1,111 @@
+package construct
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/lock"
+	"github.com/stretchr/testify/assert"
+)
+
+// testResetReservedNames empties the reserved names now and once the test
+// is done.
+func testResetReservedNames(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		reservations.mutex.Lock()
+		defer reservations.mutex.Unlock()
+		reservations.names = make(map[string]*reservation)
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestNormalizeName(t *testing.T) {
+	assert.Equal(t, "Bob", normalizeName("bOB"))
+	assert.Equal(t, "O'neil", normalizeName("o'NEIL"))
+	assert.Equal(t, nameKey("Bob"), nameKey("BOB"))
+}
+
+func TestValidateName(t *testing.T) {
+	testSetupWorld(t)
+	testResetBans(t)
+	testResetReservedNames(t)
+	l := &Login{}
+
+	assert.NoError(t, l.ValidateName("Peacock"))
+	assert.Error(t, l.ValidateName("Two'bit'ed"))
+	assert.Error(t, l.ValidateName("ADMIN"))
+	assert.Error(t, l.ValidateName("Adminator"))
+	assert.Error(t, l.ValidateName("Immortal"))
+	assert.Error(t, l.ValidateName("Bigshitter"))
+
+	path := filepath.Join(t.TempDir(), "forbidden")
+	os.WriteFile(path, []byte("# Our own staff.\n^lobato$\n"), 0644)
+	config.Set("forbidden_names_file", path)
+	t.Cleanup(func() {
+		config.Set("forbidden_names_file", "")
+	})
+	assert.Error(t, l.ValidateName("Lobato"))
+	assert.NoError(t, l.ValidateName("Lobatos"))
+
+	assert.NoError(t, bans.add(&Ban{Kind: banName, Target: "Griefer", Reason: "griefing", Created: time.Now()}))
+	assert.Error(t, l.ValidateName("griefer"))
+
+	// Reserved names may only be taken by the account they are held for.
+	assert.NoError(t, reserveName(&reservation{Name: "Nobody", Created: time.Now()}))
+	assert.NoError(t, reserveName(&reservation{Name: "Heir", For: "Royal", Created: time.Now()}))
+	assert.Error(t, l.ValidateName("nobody"))
+	assert.Error(t, l.ValidateName("Heir"))
+	assert.NoError(t, (&Login{account: NewAccount("Royal")}).ValidateName("heir"))
+	assert.NoError(t, (&Login{}).ValidateName("Royal"))
+
+	// Reserved names are kept on disk.
+	assert.NoError(t, LoadReservedNames())
+	assert.Len(t, listReservedNames(), 2)
+	r, err := unreserveName("NOBODY")
+	assert.NoError(t, err)
+	assert.NotNil(t, r)
+	assert.NoError(t, LoadReservedNames())
+	assert.NoError(t, l.ValidateName("Nobody"))
+}
+
+func TestNamesIgnoreCase(t *testing.T) {
+	testSetupWorld(t)
+	testLoginNewUser(t, "mIxEd")
+	p := testFindPlayer(t, "MIXED")
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+	assert.Equal(t, "Mixed", p.GetName(ctx))
+	assert.True(t, characterExists("mixed"))
+	assert.Equal(t, "Mixed", testLoadAccount("MiXeD").GetName())
+
+	assert.Eventually(t, func() bool {
+		return p.GetRoom(ctx) != nil
+	}, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, p, p.GetRoom(ctx).GetPlayer(ctx, "mix"))
+	assert.Equal(t, p, p.TargetPlayer(ctx, "MIX", "room"))
+}
+
+func TestReserveCommand(t *testing.T) {
+	testSetupWorld(t)
+	testResetReservedNames(t)
+	testLoginNewUser(t, "Keeper")
+	keeper := testFindPlayer(t, "Keeper")
+	ctx := lock.Context(keeper.Context(), keeper.Data.UUID+"test")
+	keeper.setRole(ctx, roleAdmin)
+
+	assert.NoError(t, keeper.Command("reserve heir royal"))
+	assert.Eventually(t, func() bool {
+		return reservedName("Heir") != nil
+	}, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, "Royal", reservedName("heir").For)
+	assert.Equal(t, "Keeper", reservedName("heir").By)
+
+	assert.NoError(t, keeper.Command("unreserve Heir"))
+	assert.Eventually(t, func() bool {
+		return reservedName("Heir") == nil
+	}, time.Second*5, time.Millisecond*10)
+}
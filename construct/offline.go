@@ -0,0 +1,287 @@
+package construct
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/storage"
+)
+
+// The functions in this file work on saved characters directly, for tools
+// such as gomud-admin that run while the game is offline. They go through
+// the same save code as the game, so saved characters are migrated, backed
+// up and kept in step with their accounts just as they are in game. Using
+// them while the game is running may lose changes either side makes.
+
+// ErrNoCharacter is returned when there is no saved character by a name.
+var ErrNoCharacter = errors.New("no such character")
+
+// Character is a summary of a saved character.
+type Character struct {
+	Name    string
+	Key     string
+	Account string
+	Role    string
+	Race    string
+	Class   string
+	// Err is set if the character couldn't be read, in which case only Key
+	// is set, or if their account couldn't be.
+	Err error
+}
+
+// Characters returns every saved character, ordered by name. A character
+// that can't be read is still listed, with the reason, so that one damaged
+// pfile doesn't hide the rest.
+func Characters() ([]*Character, error) {
+	keys, err := recordKeys(storage.Players)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Character
+	for _, key := range keys {
+		c := &Character{Key: key}
+		list = append(list, c)
+		raw, err := loadRecord(storage.Players, key)
+		if err != nil {
+			c.Err = err
+			continue
+		}
+		data := &playerData{}
+		if _, err := playerSchema.load(raw, data); err != nil {
+			c.Err = err
+			continue
+		}
+		c.Name = data.Name
+		c.Role = data.Role.String()
+		c.Race = data.Race
+		c.Class = data.Class
+		if data.Account != "" {
+			if a, found, err := loadAccountByUUID(data.Account); err != nil {
+				c.Err = fmt.Errorf("account %s: %w", data.Account, err)
+			} else if found {
+				c.Account = a.GetName()
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if nameKey(list[i].Name) == nameKey(list[j].Name) {
+			return list[i].Key < list[j].Key
+		}
+		return nameKey(list[i].Name) < nameKey(list[j].Name)
+	})
+	return list, nil
+}
+
+// CharacterJSON returns a saved character as indented JSON, migrated to
+// the current version.
+func CharacterJSON(name string) ([]byte, error) {
+	data, err := findPlayerData(name)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(data, "", "  ")
+}
+
+// ResetPassword sets a new password for a character. Characters log in
+// with their account's password, so the account is changed if the
+// character has one. Characters from before accounts keep their own.
+func ResetPassword(name, password string) error {
+	data, err := findPlayerData(name)
+	if err != nil {
+		return err
+	}
+	if data.Account == "" {
+		if err := validatePassword(data.Name, password); err != nil {
+			return err
+		}
+		data.Password = hashPassword(password)
+		return savePlayerData(data)
+	}
+	a, found, err := loadAccountByUUID(data.Account)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("the account of %s doesn't exist", data.Name)
+	}
+	if err := validatePassword(a.GetName(), password); err != nil {
+		return err
+	}
+	a.SetPassword(password)
+	return a.Save()
+}
+
+// RenameCharacter gives a saved character a new name, and saves them and
+// their backups under the key for it. The new name must pass the same
+// checks as a new character's, so bans and reserved names should be loaded
+// first.
+func RenameCharacter(from, to string) error {
+	data, err := findPlayerData(from)
+	if err != nil {
+		return err
+	}
+	account := to
+	if data.Account != "" {
+		a, found, err := loadAccountByUUID(data.Account)
+		if err != nil {
+			return err
+		}
+		if found {
+			account = a.GetName()
+		}
+	}
+	sameName := nameKey(to) == nameKey(data.Name)
+	if !sameName {
+		if err := checkNewName(to, account); err != nil {
+			return err
+		}
+		// The owner's name makes whoever has it an owner.
+		if owner := config.GetString("owner"); owner != "" && nameKey(owner) == nameKey(to) {
+			return errors.New("That name is reserved.")
+		}
+	} else if err := validNameFormat(to); err != nil {
+		return err
+	}
+	to = normalizeName(to)
+	if !sameName && characterExists(to) {
+		return fmt.Errorf("there is already a character named %s", to)
+	}
+	old := data.Name
+	data.Name = to
+	if err := savePlayerData(data); err != nil {
+		return err
+	}
+	if err := renameAccountCharacter(data.Account, data.UUID, to); err != nil {
+		return err
+	}
+	// A change of case only is saved under the same key.
+	if playerKey(old) == playerKey(to) {
+		return nil
+	}
+	if err := renameBackups(old, to); err != nil {
+		return err
+	}
+	return deleteCharacter(old)
+}
+
+// DeleteCharacter removes a saved character and takes them off their
+// account. The character is backed up first, so the deletion can be undone
+// with restore.
+func DeleteCharacter(name string) error {
+	data, err := findPlayerData(name)
+	if err != nil {
+		return err
+	}
+	if err := backupPlayer(data.Name); err != nil {
+		return err
+	}
+	if data.Account != "" {
+		a, found, err := loadAccountByUUID(data.Account)
+		if err != nil {
+			return err
+		}
+		if found {
+			a.RemoveCharacter(data.Name)
+			if err := a.Save(); err != nil {
+				return err
+			}
+		}
+	}
+	return deleteCharacter(data.Name)
+}
+
+// SetCharacterFlag sets or clears a flag on a saved character.
+func SetCharacterFlag(name, flag string, on bool) error {
+	data, err := findPlayerData(name)
+	if err != nil {
+		return err
+	}
+	if data.Flags == nil {
+		data.Flags = make(map[string]bool)
+	}
+	if on {
+		data.Flags[flag] = true
+	} else {
+		delete(data.Flags, flag)
+	}
+	return savePlayerData(data)
+}
+
+// SetCharacterStat sets a stat, such as max_health, or an attribute, such
+// as str, on a saved character.
+func SetCharacterStat(name, stat string, value int64) error {
+	data, err := findPlayerData(name)
+	if err != nil {
+		return err
+	}
+	if data.Stats != nil {
+		if field := data.Stats.field(stat); field != nil {
+			*field = value
+			return savePlayerData(data)
+		}
+	}
+	for _, attr := range attributeNames {
+		if attr == stat && data.Attributes != nil {
+			data.Attributes.set(stat, value)
+			return savePlayerData(data)
+		}
+	}
+	return fmt.Errorf("there is no stat %s", stat)
+}
+
+// findPlayerData loads a saved character, returning ErrNoCharacter if there
+// is no such character.
+func findPlayerData(name string) (*playerData, error) {
+	data, found, err := loadPlayerData(name)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s: %w", name, ErrNoCharacter)
+	}
+	return data, nil
+}
+
+// loadAccountByUUID loads an account by its UUID. Returns false if no such
+// account exists.
+func loadAccountByUUID(id string) (*Account, bool, error) {
+	a := newAccountByUUID(id, "")
+	found, err := a.Load()
+	return a, found, err
+}
+
+// renameAccountCharacter renames a character in the list of characters on
+// their account.
+func renameAccountCharacter(account, id, name string) error {
+	if account == "" {
+		return nil
+	}
+	a, found, err := loadAccountByUUID(account)
+	if err != nil || !found {
+		return err
+	}
+	a.RenameCharacter(id, name)
+	return a.Save()
+}
+
+// addAccountCharacter puts a character back on their account, if they are
+// no longer on it, such as when they are restored after being deleted.
+func addAccountCharacter(account, id, name string) error {
+	if account == "" {
+		return nil
+	}
+	a, found, err := loadAccountByUUID(account)
+	if err != nil || !found {
+		return err
+	}
+	for _, c := range a.Characters() {
+		if c.UUID == id {
+			return nil
+		}
+	}
+	a.AddCharacter(id, name)
+	return a.Save()
+}
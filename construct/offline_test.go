@@ -0,0 +1,133 @@
+package construct
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// testSaveCharacter saves a character on an account of the same name,
+// without logging in.
+func testSaveCharacter(t *testing.T, name string) *playerData {
+	t.Helper()
+	a := NewAccount(name)
+	a.SetPassword(testPassword)
+	data := NewPlayer().Data
+	data.Name = name
+	data.Account = a.GetUUID()
+	a.AddCharacter(data.UUID, name)
+	assert.NoError(t, a.Save())
+	assert.NoError(t, savePlayerData(data))
+	return data
+}
+
+func TestOfflineCharacters(t *testing.T) {
+	testSetupWorld(t)
+	testSaveCharacter(t, "Zed")
+	testSaveCharacter(t, "Amber")
+	// A damaged pfile is listed by its key, and doesn't hide the rest.
+	assert.NoError(t, saveRecord(storage.Players, playerKey("Broken"), []byte(`{"Name": `)))
+
+	list, err := Characters()
+	assert.NoError(t, err)
+	if assert.Len(t, list, 3) {
+		assert.Empty(t, list[0].Name)
+		assert.Equal(t, playerKey("Broken"), list[0].Key)
+		assert.ErrorIs(t, list[0].Err, ErrCorrupt)
+		assert.Equal(t, "Amber", list[1].Name)
+		assert.Equal(t, "Amber", list[1].Account)
+		assert.Equal(t, playerKey("Amber"), list[1].Key)
+		assert.NoError(t, list[1].Err)
+		assert.Equal(t, "Zed", list[2].Name)
+	}
+
+	raw, err := CharacterJSON("amber")
+	assert.NoError(t, err)
+	data := &playerData{}
+	assert.NoError(t, json.Unmarshal(raw, data))
+	assert.Equal(t, "Amber", data.Name)
+
+	_, err = CharacterJSON("Nobody")
+	assert.ErrorIs(t, err, ErrNoCharacter)
+}
+
+func TestOfflineEdits(t *testing.T) {
+	testSetupWorld(t)
+	saved := testSaveCharacter(t, "Tinker")
+
+	assert.NoError(t, ResetPassword("Tinker", "brand new secret"))
+	a := NewAccount("Tinker")
+	found, err := a.Load()
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.True(t, a.IsPassword("brand new secret"))
+	assert.Error(t, ResetPassword("Tinker", "short"))
+
+	assert.NoError(t, SetCharacterFlag("Tinker", "autobuild", true))
+	assert.NoError(t, SetCharacterStat("Tinker", "max_health", 500))
+	assert.NoError(t, SetCharacterStat("Tinker", "str", 18))
+	assert.Error(t, SetCharacterStat("Tinker", "luck", 1))
+	data, _, err := loadPlayerData("Tinker")
+	assert.NoError(t, err)
+	assert.True(t, data.Flags["autobuild"])
+	assert.Equal(t, int64(500), data.Stats.MaxHealth)
+	assert.Equal(t, int64(18), data.Attributes.Str)
+
+	// Renaming moves the pfile and its backups to the new name's key and
+	// keeps the account pointing at the character.
+	before, err := playerBackups("Tinker")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, before)
+	assert.NoError(t, RenameCharacter("Tinker", "tailor"))
+	assert.False(t, characterExists("Tinker"))
+	data, found, err = loadPlayerData("Tailor")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "Tailor", data.Name)
+	assert.Equal(t, saved.UUID, data.UUID)
+	_, err = a.Load()
+	assert.NoError(t, err)
+	if c := a.Character("Tailor"); assert.NotNil(t, c) {
+		assert.Equal(t, saved.UUID, c.UUID)
+	}
+	backups, err := playerBackups("Tailor")
+	assert.NoError(t, err)
+	assert.Len(t, backups, len(before))
+	if len(backups) > 0 {
+		restored, err := loadBackup("Tailor", backups[0])
+		assert.NoError(t, err)
+		assert.Equal(t, saved.UUID, restored.UUID)
+	}
+	backups, err = playerBackups("Tinker")
+	assert.NoError(t, err)
+	assert.Empty(t, backups)
+	testSaveCharacter(t, "Soldier")
+	assert.Error(t, RenameCharacter("Tailor", "Soldier"))
+
+	// The new name must be one a new character could take.
+	assert.Error(t, RenameCharacter("Tailor", "Administrator"))
+	assert.NoError(t, reserveName(&reservation{Name: "Heiress", For: "Someone", Created: time.Now()}))
+	assert.Error(t, RenameCharacter("Tailor", "Heiress"))
+	config.Set("owner", "Founder")
+	t.Cleanup(func() {
+		config.Set("owner", "")
+	})
+	assert.Error(t, RenameCharacter("Tailor", "Founder"))
+	assert.True(t, characterExists("Tailor"))
+
+	// Deleting backs the character up first.
+	assert.NoError(t, DeleteCharacter("Tailor"))
+	assert.False(t, characterExists("Tailor"))
+	_, err = a.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, a.Characters())
+	backups, err = playerBackups("Tailor")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, backups)
+	_, err = loadRecord(storage.Players, playerKey("Tailor"))
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
@@ -0,0 +1,183 @@
+package construct
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/argon2"
+)
+
+// Passwords are stored in the PHC string format, i.e.
+// $argon2id$v=19$m=65536,t=1,p=2$<salt>$<hash>, so that the algorithm and
+// cost parameters travel with the hash. Hashes from before this format
+// existed are a bare hex encoded SHA-512 and are upgraded on login.
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// argon2Params are the cost parameters for an argon2id hash.
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+// currentArgon2Params returns the configured cost parameters for new hashes.
+func currentArgon2Params() argon2Params {
+	return argon2Params{
+		memory:  uint32(config.GetInt("argon2_memory")),
+		time:    uint32(config.GetInt("argon2_time")),
+		threads: uint8(config.GetInt("argon2_threads")),
+	}
+}
+
+// hashPassword hashes a password with argon2id and a random salt using the
+// configured cost parameters.
+func hashPassword(pw string) string {
+	params := currentArgon2Params()
+	salt := make([]byte, argon2SaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		// There's no safe way to store a password without a salt.
+		log.Panic().Err(err).Msg("unable to generate password salt")
+	}
+	key := argon2.IDKey([]byte(pw), salt, params.time, params.memory, params.threads, argon2KeyLength)
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.memory,
+		params.time,
+		params.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+// hashLegacyPassword is the old unsalted SHA-512 password hash.
+func hashLegacyPassword(pw string) string {
+	h := sha512.New()
+	io.WriteString(h, pw)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// isLegacyHash returns true if the hash is an old SHA-512 hash.
+func isLegacyHash(hash string) bool {
+	return !strings.HasPrefix(hash, "$")
+}
+
+// parseArgon2Hash splits an argon2id hash into its parameters, salt and
+// key.
+func parseArgon2Hash(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, fmt.Errorf("unknown password hash format")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, err
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	return params, salt, key, nil
+}
+
+// checkPassword returns true if the password matches the stored hash, in
+// either the current or the legacy format.
+func checkPassword(hash, pw string) bool {
+	if isLegacyHash(hash) {
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(hashLegacyPassword(pw))) == 1
+	}
+	params, salt, key, err := parseArgon2Hash(hash)
+	if err != nil {
+		return false
+	}
+	other := argon2.IDKey([]byte(pw), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+// passwordNeedsRehash returns true if the hash is in the legacy format or
+// was made with cost parameters other than the configured ones.
+func passwordNeedsRehash(hash string) bool {
+	if isLegacyHash(hash) {
+		return true
+	}
+	params, _, _, err := parseArgon2Hash(hash)
+	return err != nil || params != currentArgon2Params()
+}
+
+// commonPasswords are refused outright, on top of any listed in the file
+// named by the password_deny_file config key.
+var commonPasswords = []string{
+	"123456", "12345678", "123456789", "1234567890", "1q2w3e4r", "111111",
+	"000000", "abc123", "password", "password1", "passw0rd", "qwerty",
+	"qwertyuiop", "qwerty123", "iloveyou", "letmein", "welcome", "monkey",
+	"dragon", "master", "sunshine", "princess", "football", "baseball",
+	"superman", "trustno1", "shadow", "michael", "whatever", "starwars",
+	"admin", "administrator", "changeme", "secret", "gandalf", "mudder",
+}
+
+// isCommonPassword returns true if the password is on the deny list.
+func isCommonPassword(pw string) bool {
+	pw = strings.ToLower(pw)
+	for _, common := range commonPasswords {
+		if pw == common {
+			return true
+		}
+	}
+	path := config.GetString("password_deny_file")
+	if path == "" {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Error().Err(err).Str("path", path).Msg("Unable to read password deny file.")
+		return false
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if strings.ToLower(strings.TrimSpace(s.Text())) == pw {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePassword checks a new password for the given character against the
+// password policy. The returned error is suitable for showing to the player.
+func validatePassword(name, pw string) error {
+	if min := config.GetInt("password_min_length"); len(pw) < min {
+		return fmt.Errorf("Your password must be at least %d characters long.", min)
+	}
+	if name != "" && strings.Contains(strings.ToLower(pw), strings.ToLower(name)) {
+		return errors.New("Your password may not contain your name.")
+	}
+	if isCommonPassword(pw) {
+		return errors.New("That password is too common, pick something harder to guess.")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package construct
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/lock"
+	"github.com/Cidan/gomud/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashPassword(t *testing.T) {
+	testSetupWorld(t)
+	hash := hashPassword("hunter2")
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=2$"))
+	assert.NotEqual(t, hash, hashPassword("hunter2"), "hashes must be salted")
+	assert.True(t, checkPassword(hash, "hunter2"))
+	assert.False(t, checkPassword(hash, "hunter3"))
+	assert.False(t, passwordNeedsRehash(hash))
+
+	config.Set("argon2_time", 2)
+	defer config.Set("argon2_time", 1)
+	assert.True(t, passwordNeedsRehash(hash))
+	assert.True(t, checkPassword(hash, "hunter2"))
+}
+
+func TestLegacyPassword(t *testing.T) {
+	hash := hashLegacyPassword("hunter2")
+	assert.True(t, checkPassword(hash, "hunter2"))
+	assert.False(t, checkPassword(hash, "hunter3"))
+	assert.True(t, passwordNeedsRehash(hash))
+	assert.False(t, checkPassword("$argon2id$garbage", "hunter2"))
+}
+
+func TestLegacyPasswordUpgradedOnLogin(t *testing.T) {
+	testSetupWorld(t)
+	r, w := testLoginNewUser(t, "Legacy")
+	runCommands(t, r, w, []string{"quit"})
+	id := accountUUID("Legacy")
+	readData := func() *accountData {
+		data := &accountData{}
+		raw, err := loadRecord(storage.Accounts, id)
+		if err != nil || json.Unmarshal(raw, data) != nil {
+			return nil
+		}
+		return data
+	}
+	// Wait for the player to be fully out of the world, so the next login
+	// doesn't attach to the old session.
+	assert.Eventually(t, func() bool {
+		return Atlas.GetPlayer("Legacy") == nil
+	}, time.Second*5, time.Millisecond*10)
+
+	// Rewrite the account as it would have been saved before salted hashes.
+	data := readData()
+	assert.NotNil(t, data)
+	data.Password = hashLegacyPassword(testPassword)
+	raw, err := json.Marshal(data)
+	assert.NoError(t, err)
+	assert.NoError(t, saveRecord(storage.Accounts, id, raw))
+
+	testLoginUser(t, "Legacy")
+	assert.Eventually(t, func() bool {
+		data = readData()
+		return data != nil && !isLegacyHash(data.Password)
+	}, time.Second*5, time.Millisecond*10)
+	assert.True(t, checkPassword(data.Password, testPassword))
+}
+
+func TestValidatePassword(t *testing.T) {
+	assert.Error(t, validatePassword("Bob", "short"))
+	assert.Error(t, validatePassword("Bob", "mynameisbob"))
+	assert.Error(t, validatePassword("Bob", "Password1"))
+	assert.NoError(t, validatePassword("Bob", "correct horse battery"))
+
+	deny := filepath.Join(t.TempDir(), "deny.txt")
+	assert.NoError(t, ioutil.WriteFile(deny, []byte("correct horse battery\n"), 0644))
+	config.Set("password_deny_file", deny)
+	defer config.Set("password_deny_file", "")
+	assert.Error(t, validatePassword("Bob", "Correct Horse Battery"))
+}
+
+func TestChangePassword(t *testing.T) {
+	testSetupWorld(t)
+	r, w := testLoginNewUser(t, "Changer")
+	p := testFindPlayer(t, "Changer")
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+	isPassword := func(pw string) bool {
+		return p.GetAccount(ctx).IsPassword(pw)
+	}
+	runCommands(t, r, w, []string{
+		"password",
+		testPassword,
+		"changer12345",
+		"another good one",
+		"another good one",
+	})
+	assert.Eventually(t, func() bool {
+		return isPassword("another good one")
+	}, time.Second*5, time.Millisecond*10)
+	assert.Eventually(t, func() bool {
+		return p.interpName(ctx) == "game"
+	}, time.Second*5, time.Millisecond*10)
+
+	// A wrong old password leaves the password alone.
+	runCommands(t, r, w, []string{
+		"password",
+		"not my password",
+	})
+	assert.Eventually(t, func() bool {
+		return p.interpName(ctx) == "game"
+	}, time.Second*5, time.Millisecond*10)
+	assert.True(t, isPassword("another good one"))
+}
@@ -1,39 +1,33 @@
 package construct
 
 import (
-	"bufio"
 	"context"
-	"crypto/sha512"
-	"encoding/hex"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net"
 	"strings"
 	"time"
 
 	"github.com/Cidan/gomud/color"
-	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/limit"
 	"github.com/Cidan/gomud/lock"
+	"github.com/Cidan/gomud/storage"
+	"github.com/Cidan/gomud/telnet"
 	"github.com/rs/zerolog/log"
 	uuid "github.com/satori/go.uuid"
 )
 
-func hashPassword(pw string) string {
-	h := sha512.New()
-	io.WriteString(h, pw)
-	return hex.EncodeToString(h.Sum(nil))
-}
-
 // Player construct
 type Player struct {
-	connection     net.Conn
+	connection     *telnet.Conn
 	input          chan string //*bufio.Reader
 	Data           *playerData
 	gameInterp     *Game
 	buildInterp    *BuildInterp
 	textInterp     *TextInterp
+	passwordInterp *PasswordInterp
 	loginInterp    *Login
 	currentInterp  Interp
 	inRoom         *Room
@@ -42,6 +36,16 @@ type Player struct {
 	ctx            context.Context
 	cancel         context.CancelFunc
 	lastActionTime time.Time
+	gmcpSupports   map[string]int
+	secure         bool
+	address        string
+	idleStage      int
+	voidFrom       *Room
+	account        *Account
+	link           *link
+	relinked       chan struct{}
+	linkdead       bool
+	linkdeadSince  time.Time
 }
 
 // This is the main data construct for a human player. Any new flags, attributes
@@ -50,13 +54,19 @@ type Player struct {
 // above for temporary data that does not need to be saved.
 // Additionally, all player fields must be exported in order to be saved.
 type playerData struct {
-	UUID     string
-	Name     string
-	Password string
-	Room     string
-	Flags    map[string]bool
-	Prompt   string
-	Stats    *playerStats
+	Version    int
+	UUID       string
+	Name       string
+	Password   string
+	Account    string
+	Role       role
+	Race       string
+	Class      string
+	Room       string
+	Flags      map[string]bool
+	Prompt     string
+	Stats      *playerStats
+	Attributes *playerAttributes
 }
 
 // TODO(lobato): use consts instead of strings.
@@ -69,6 +79,26 @@ type playerStats struct {
 	MaxMove   int64
 }
 
+// field returns the stat with the given name, or nil if there is no such
+// stat.
+func (s *playerStats) field(key string) *int64 {
+	switch key {
+	case "health":
+		return &s.Health
+	case "mana":
+		return &s.Mana
+	case "move":
+		return &s.Move
+	case "max_health":
+		return &s.MaxHealth
+	case "max_mana":
+		return &s.MaxMana
+	case "max_move":
+		return &s.MaxMove
+	}
+	return nil
+}
+
 type roomWalk struct {
 	room *Room
 	mx   int64
@@ -81,12 +111,15 @@ func NewPlayer() *Player {
 	ctx, cancel := context.WithCancel(lock.Context(context.Background(), uuid))
 	p := &Player{
 		Data: &playerData{
-			UUID:  uuid,
-			Flags: make(map[string]bool),
-			Stats: &playerStats{},
+			Version:    playerSchema.version(),
+			UUID:       uuid,
+			Flags:      make(map[string]bool),
+			Stats:      &playerStats{},
+			Attributes: &playerAttributes{},
 		},
 		lastActionTime: time.Now(),
 		input:          make(chan string),
+		relinked:       make(chan struct{}, 1),
 		lock:           lock.New(uuid),
 		ctx:            ctx,
 		cancel:         cancel,
@@ -106,26 +139,28 @@ func (p *Player) setDefaults(ctx context.Context) {
 	p.EnableFlag(ctx, "prompt")
 	p.EnableFlag(ctx, "color")
 	p.EnableFlag(ctx, "automap")
+	p.EnableFlag(ctx, "compress")
 	p.SetPrompt("<%h{gh{x %m{bm{x %v{yv{x>")
-	p.ModifyStat("health", 100, false)
-	p.ModifyStat("mana", 100, false)
-	p.ModifyStat("move", 100, false)
-	p.ModifyStat("max_health", 100, false)
-	p.ModifyStat("max_mana", 100, false)
-	p.ModifyStat("max_move", 100, false)
+	p.ModifyStat(ctx, "health", 100, false)
+	p.ModifyStat(ctx, "mana", 100, false)
+	p.ModifyStat(ctx, "move", 100, false)
+	p.ModifyStat(ctx, "max_health", 100, false)
+	p.ModifyStat(ctx, "max_mana", 100, false)
+	p.ModifyStat(ctx, "max_move", 100, false)
 }
 
 // playerTick is this specific player's tick timer. This is where you add
 // effects such as combat actions, damage dealt, status effects, and other
 // things the player should do/have happen to them over time.
 func (p *Player) playerTick() {
-	// TODO(lobato): setup idle ticker
+	ctx := lock.Context(p.ctx, p.GetUUID(p.ctx)+"tick")
 	minuteTicker := time.NewTicker(time.Minute)
 	secondTicker := time.NewTicker(time.Second)
 	for {
 		select {
 		case <-secondTicker.C:
-			break
+			p.checkLinkdead(ctx)
+			p.checkIdle(ctx)
 		case <-minuteTicker.C:
 			break
 		case <-p.ctx.Done():
@@ -136,83 +171,205 @@ func (p *Player) playerTick() {
 	}
 }
 
-// SetConnection sets the player connection object
+// SetConnection sets the player connection object. Raw connections are
+// wrapped in a telnet connection so that option negotiation never reaches
+// the interp.
 func (p *Player) SetConnection(ctx context.Context, c net.Conn) {
+	tc, ok := c.(*telnet.Conn)
+	if !ok {
+		tc = telnet.NewConn(c)
+	}
+	l := newLink(tc)
 	p.lock.Lock(ctx)
-	p.connection = c
+	old := p.link
+	p.link = l
+	p.connection = tc
+	p.secure = isSecure(c)
+	p.address = limit.Host(c.RemoteAddr())
 	p.lock.Unlock(ctx)
-	s := bufio.NewScanner(c)
-	// Wrap our reader in a channel so that we can select it
-	// in the interp loop. When the connection is closed by p.Stop(),
-	// this loop will break.
-	go func(s *bufio.Scanner) {
-		for {
-			if !s.Scan() {
-				break
-			}
-			p.input <- s.Text()
-		}
-	}(s)
+	tc.HandleSubnegotiation(telnet.OptGMCP, p.handleGMCP)
+	if old != nil {
+		old.close()
+	}
+	p.relink()
+}
+
+// SecureConn is implemented by connections that know whether they are
+// encrypted, for connections that don't expose a *tls.Conn directly.
+type SecureConn interface {
+	Secure() bool
+}
+
+// isSecure returns true if the connection is encrypted.
+func isSecure(c net.Conn) bool {
+	switch conn := c.(type) {
+	case *tls.Conn:
+		return true
+	case *telnet.Conn:
+		return isSecure(conn.Conn)
+	case SecureConn:
+		return conn.Secure()
+	default:
+		return false
+	}
+}
+
+// IsSecure returns true if the player is connected over an encrypted
+// connection.
+func (p *Player) IsSecure(ctx context.Context) bool {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	return p.secure
+}
+
+// GetAddress returns the address the player is connected from.
+func (p *Player) GetAddress(ctx context.Context) string {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	return p.address
 }
 
 func (p *Player) Context() context.Context {
 	return p.ctx
 }
 
-// Disconnect this player without unloading them from the world.
+// Disconnect this player without unloading them from the world. A player in
+// the world is left link dead.
 func (p *Player) Disconnect() {
-	p.connection.Close()
+	ctx := lock.Context(p.ctx, p.GetUUID(p.ctx)+"disconnect")
+	if l := p.getLink(ctx); l != nil {
+		l.close()
+	}
 }
 
-// Start this player and their interp loop.
-func (p *Player) Start() {
+// newInterps creates the player's interps.
+func (p *Player) newInterps() {
 	p.buildInterp = NewBuildInterp(p)
 	p.gameInterp = NewGameInterp(p)
 	p.loginInterp = NewLoginInterp(p)
 	p.textInterp = NewTextInterp(p)
+	p.passwordInterp = NewPasswordInterp(p)
+}
+
+// Start this player and their interp loop.
+func (p *Player) Start() {
+	p.newInterps()
 	ctx := lock.Context(p.ctx, p.GetUUID(p.ctx)+"login")
 	p.Login(ctx)
 
+	if err := p.connection.Negotiate(); err != nil {
+		log.Error().Err(err).Str("player", p.Data.UUID).Msg("Unable to negotiate telnet options.")
+	}
 	p.Write(ctx, "Welcome, by what name are you known?")
+	p.run()
+}
 
+// Resume puts a player that was connected before a reboot back into the
+// world, skipping the login, and runs their interp loop. The connection
+// must already be set.
+func (p *Player) Resume(state *copyoverPlayer) {
+	p.newInterps()
+	ctx := lock.Context(p.ctx, p.GetUUID(p.ctx)+"resume")
+	p.Login(ctx)
+	p.connection.Restore(state.Telnet)
+
+	p.SetName(ctx, state.Name)
+	if loaded, err := p.Load(ctx); err != nil || !loaded {
+		log.Error().Err(err).Str("player", state.Name).Msg("Unable to load player after reboot.")
+		p.Write(ctx, "Something went wrong restoring your session, please log in again.")
+		p.cancel()
+		p.run()
+		return
+	}
+	if id := p.GetData(ctx).Account; id != "" {
+		account := newAccountByUUID(id, "")
+		if loaded, err := account.Load(); err != nil || !loaded {
+			log.Error().Err(err).Str("player", state.Name).Msg("Unable to load account after reboot.")
+		} else {
+			p.setAccount(ctx, account)
+		}
+	}
+	if existingPlayer := Atlas.AddPlayer(ctx, p); existingPlayer != nil {
+		log.Error().Str("player", state.Name).Msg("Player already restored after reboot.")
+		p.cancel()
+		p.run()
+		return
+	}
+
+	p.applyCompression(ctx)
+	if target := Atlas.GetRoomByUUID(state.Room); target != nil {
+		p.ToRoom(ctx, target)
+	} else {
+		p.ToRoom(ctx, Atlas.GetRoom(0, 0, 0))
+	}
+	switch state.Interp {
+	case "build", "text":
+		// Text buffers don't survive a reboot, so editors are dropped back
+		// into build mode.
+		p.Build(ctx)
+	default:
+		p.Game(ctx)
+	}
+	p.Write(ctx, "{GThe realm has been rebooted.{x")
+	p.Command("look")
+	p.run()
+}
+
+// run is the player interp loop, which runs until the player context is
+// canceled.
+func (p *Player) run() {
+	go p.playerTick()
+	ctx := lock.Context(p.ctx, p.GetUUID(p.ctx)+"interp")
 	for {
+		// Input comes from the current link, which changes when the
+		// player reconnects, and from commands run for the player. A link
+		// dead player has no link, and a nil channel is never ready.
+		l := p.getLink(ctx)
+		var lines chan string
+		if l != nil {
+			lines = l.lines
+		}
+		var str string
 		select {
 		case <-p.ctx.Done():
 			log.Info().Str("player", p.Data.UUID).Msg("Player context canceled, closing connection.")
 			if p.currentInterp == p.textInterp {
 				p.Command(":q")
 			}
-			if conn := p.connection; conn != nil {
-				conn.Close()
+			if l := p.getLink(ctx); l != nil {
+				l.close()
 			}
-			close(p.input)
 			return
-		case str := <-p.input:
-			// TODO(lobato): interp changes?
-			select {
-			default:
-				break
-			}
-			str = strings.TrimSpace(str)
-			ctx := lock.Context(p.ctx, p.GetUUID(p.ctx)+"interp")
-			p.lock.Lock(ctx)
-			err := p.currentInterp.Read(ctx, str)
-			p.lastActionTime = time.Now()
-			p.lock.Unlock(ctx)
-			switch err {
-			case ErrCommandNotFound:
-				p.Write(ctx, "Huh?")
-			case nil:
-				break
-			default:
-				log.Error().Err(err).
-					Str("player", p.Data.UUID).
-					Msg("Error interpreting input from player.")
-				log.Debug().Msg(str)
+		case <-p.relinked:
+			continue
+		case line, ok := <-lines:
+			if !ok {
+				p.linkLost(ctx, l)
+				continue
 			}
-			// Slow down the player a bit.
-			time.Sleep(time.Millisecond * 15)
+			str = line
+		case str = <-p.input:
 		}
+
+		str = strings.TrimSpace(str)
+		p.wake(ctx)
+		p.lock.Lock(ctx)
+		err := p.currentInterp.Read(ctx, str)
+		p.lastActionTime = time.Now()
+		p.lock.Unlock(ctx)
+		switch err {
+		case ErrCommandNotFound:
+			p.Write(ctx, "Huh?")
+		case nil:
+			break
+		default:
+			log.Error().Err(err).
+				Str("player", p.Data.UUID).
+				Msg("Error interpreting input from player.")
+			log.Debug().Msg(str)
+		}
+		// Slow down the player a bit.
+		time.Sleep(time.Millisecond * 15)
 	}
 }
 
@@ -231,7 +388,7 @@ func (p *Player) Flush(ctx context.Context) {
 		p.textBuffer = color.Strip(p.textBuffer)
 	}
 
-	p.WriteRaw(ctx, "%s\r\xff\xf9", p.textBuffer)
+	p.WriteRaw(ctx, "%s\r%s", p.textBuffer, p.promptEnd(ctx))
 	p.WritePrompt(ctx)
 
 	p.lock.Lock(ctx)
@@ -248,7 +405,7 @@ func (p *Player) Write(ctx context.Context, text string, args ...interface{}) {
 		str = color.Strip(str)
 	}
 
-	p.WriteRaw(ctx, "%s\r\xff\xf9", str)
+	p.WriteRaw(ctx, "%s\r%s", str, p.promptEnd(ctx))
 	p.WritePrompt(ctx)
 }
 
@@ -264,7 +421,7 @@ func (p *Player) WritePrompt(ctx context.Context) {
 	p.lock.Lock(ctx)
 	if p.currentInterp == p.textInterp {
 		defer p.lock.Unlock(ctx)
-		p.WriteRaw(ctx, "\n[:w to save, :q to quit]\r\xff\xf9")
+		p.WriteRaw(ctx, "\n[:w to save, :q to quit]\r%s", p.promptEnd(ctx))
 		return
 	}
 	p.lock.Unlock(ctx)
@@ -274,7 +431,7 @@ func (p *Player) WritePrompt(ctx context.Context) {
 		return
 	}
 	if p.ShowPrompt(ctx) {
-		p.WriteRaw(ctx, "\n\n%s\r\xff\xf9", str)
+		p.WriteRaw(ctx, "\n\n%s\r%s", str, p.promptEnd(ctx))
 	}
 }
 
@@ -287,7 +444,7 @@ func (p *Player) BuildPrompt(ctx context.Context) {
 	}
 
 	str := fmt.Sprintf(
-		"\n\nRoom %d,%d,%d autobuild: %s >\r\xff\xf9",
+		"\n\nRoom %d,%d,%d autobuild: %s >",
 		room.Data.X,
 		room.Data.Y,
 		room.Data.Z,
@@ -300,7 +457,7 @@ func (p *Player) BuildPrompt(ctx context.Context) {
 		str = color.Strip(str)
 	}
 
-	p.WriteRaw(ctx, str)
+	p.WriteRaw(ctx, "%s\r%s", str, p.promptEnd(ctx))
 }
 
 // WriteRaw writes raw text to the player with no transforms.
@@ -308,50 +465,182 @@ func (p *Player) WriteRaw(ctx context.Context, text string, args ...interface{})
 	p.lock.Lock(ctx)
 	defer p.lock.Unlock(ctx)
 	if conn := p.connection; conn != nil {
-		fmt.Fprintf(p.connection, text, args...)
+		fmt.Fprintf(conn, text, args...)
 	}
 }
 
-// Save a player to disk
-func (p *Player) Save(ctx context.Context) error {
-	data, err := json.Marshal(p.Data)
-	if err != nil {
-		return err
+// promptEnd returns the telnet sequence the player's client expects at the
+// end of a prompt. The connection changes hands on a reconnect, so it is
+// read with the player locked.
+func (p *Player) promptEnd(ctx context.Context) string {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	if conn := p.connection; conn != nil {
+		return conn.PromptEnd()
 	}
+	return ""
+}
 
-	fname := uuid.NewV5(uuid.NamespaceOID, strings.ToLower(p.GetName(ctx)))
-	err = ioutil.WriteFile(fmt.Sprintf("%s/%s", config.GetString("save_path"), fname), data, 0644)
-	if err != nil {
-		return err
+// SetEcho asks the player's client to turn local echo of typed input on or
+// off. Echo is turned off while typing passwords.
+func (p *Player) SetEcho(ctx context.Context, on bool) {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	conn := p.connection
+	if conn == nil || conn.State().Echo == on {
+		return
+	}
+	conn.SetEcho(on)
+	// The newline typed after hidden input was never echoed, so move the
+	// client to a fresh line.
+	if on {
+		p.WriteRaw(ctx, "\r\n")
 	}
-	return nil
 }
 
-// Load a player from source. Returns true if player was loaded.
-func (p *Player) Load(ctx context.Context) (bool, error) {
+// wantsCompression returns true if the player wants their output
+// compressed. Players saved before the compress flag existed are treated as
+// having compression enabled.
+func (p *Player) wantsCompression(ctx context.Context) bool {
 	p.lock.Lock(ctx)
 	defer p.lock.Unlock(ctx)
-	fname := uuid.NewV5(uuid.NamespaceOID, strings.ToLower(p.GetName(ctx)))
-	data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", config.GetString("save_path"), fname))
-	// TODO: Make this more robust, need to know if error is because of file
-	// not found, or error reading.
-	if err != nil {
-		log.Error().Err(err).Str("player", p.Data.Name).Msg("error loading player")
+	on, ok := p.Data.Flags["compress"]
+	return !ok || on
+}
+
+// applyCompression turns output compression on or off for the player's
+// connection based on their compress flag.
+func (p *Player) applyCompression(ctx context.Context) {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	conn := p.connection
+	if conn == nil {
+		return
+	}
+	if err := conn.SetCompression(p.wantsCompression(ctx)); err != nil {
+		log.Error().Err(err).Str("player", p.Data.UUID).Msg("Unable to change compression.")
+	}
+}
+
+// TelnetState returns the negotiated telnet state of the player's
+// connection, such as window size and client name.
+func (p *Player) TelnetState(ctx context.Context) telnet.State {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	if conn := p.connection; conn != nil {
+		return conn.State()
+	}
+	return telnet.State{}
+}
+
+// playerKey returns the key a character is saved under.
+func playerKey(name string) string {
+	return uuid.NewV5(uuid.NamespaceOID, nameKey(name)).String()
+}
+
+// characterExists returns true if a character with the given name has been
+// saved. A character whose pfile couldn't be read, or was quarantined, is
+// still taken, so that the name isn't given away while it is repaired.
+func characterExists(name string) bool {
+	key := playerKey(name)
+	_, err := loadRecord(storage.Players, key)
+	if !errors.Is(err, storage.ErrNotFound) {
+		return true
+	}
+	found, err := quarantined(storage.Players, key)
+	return found || err != nil
+}
+
+// deleteCharacter removes a saved character.
+func deleteCharacter(name string) error {
+	return deleteRecord(storage.Players, playerKey(name))
+}
+
+// loadPlayerData reads a saved character without loading them into a
+// player. Returns false if no such character exists.
+func loadPlayerData(name string) (*playerData, bool, error) {
+	data := &playerData{}
+	found, err := readPlayerData(name, data)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// readPlayerData reads a saved character into data. Returns false if no
+// such character exists. A pfile that can't be read is an error, so that
+// it can't be mistaken for a new character, and one that can't be parsed
+// is quarantined and returns an error wrapping ErrCorrupt.
+func readPlayerData(name string, data interface{}) (bool, error) {
+	key := playerKey(name)
+	raw, err := loadRecord(storage.Players, key)
+	if errors.Is(err, storage.ErrNotFound) {
 		return false, nil
 	}
-	err = json.Unmarshal(data, &p.Data)
 	if err != nil {
+		log.Error().Err(err).Str("player", name).Msg("Unable to read pfile.")
+		return false, err
+	}
+	if _, err := playerSchema.load(raw, data); err != nil {
+		if errors.Is(err, ErrCorrupt) {
+			reportCorrupt("The pfile of "+normalizeName(name), storage.Players, key, raw, err)
+		}
 		return false, err
 	}
 	return true, nil
 }
 
+// savePlayerData writes character data to storage, backing up what was
+// saved before.
+func savePlayerData(data *playerData) error {
+	if err := backupPlayer(data.Name); err != nil {
+		log.Error().Err(err).Str("player", data.Name).Msg("Unable to back up player.")
+	}
+	return writePlayerData(data)
+}
+
+// writePlayerData writes character data to storage without taking a backup.
+func writePlayerData(data *playerData) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return saveRecord(storage.Players, playerKey(data.Name), raw)
+}
+
+// Save a player to storage.
+func (p *Player) Save(ctx context.Context) error {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	return savePlayerData(p.Data)
+}
+
+// autosave writes a player to storage without taking a backup. The autosave
+// runs every few seconds, and backing up each time would leave only the
+// last few seconds of play to restore from.
+func (p *Player) autosave(ctx context.Context) error {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	return writePlayerData(p.Data)
+}
+
+// Load a player from source. Returns true if player was loaded.
+func (p *Player) Load(ctx context.Context) (bool, error) {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	return readPlayerData(p.Data.Name, &p.Data)
+}
+
 // Stop a player connection and unload the player from the world.
 func (p *Player) Stop(ctx context.Context) {
 	p.lock.Lock(ctx)
 	defer p.lock.Unlock(ctx)
-	// TODO(lobato): Handle error
-	p.Save(ctx)
+	if err := p.Save(ctx); err != nil {
+		// Leave the player queued, so the autosave keeps trying.
+		reportSaveFailure("player "+p.Data.Name, err)
+	} else {
+		forgetSave("player:" + p.Data.UUID)
+	}
 	if room := p.inRoom; room != nil {
 		room.RemovePlayer(ctx, p)
 		p.inRoom = nil
@@ -383,8 +672,13 @@ func (p *Player) ToRoom(ctx context.Context, target *Room) bool {
 	}
 
 	p.inRoom = target
-	p.Data.Room = target.Data.UUID
+	// Players in the void are saved in the room they left.
+	if !target.void {
+		p.Data.Room = target.Data.UUID
+	}
 	target.AddPlayer(ctx, p)
+	p.markDirty(ctx)
+	p.sendGMCPRoom(ctx, target)
 	return true
 }
 
@@ -399,7 +693,10 @@ func (p *Player) GetRoom(ctx context.Context) *Room {
 func (p *Player) Command(cmd string) error {
 	// Commands lock the interp via input, so spool this off.
 	go func(p *Player, cmd string) {
-		p.input <- cmd + "\n"
+		select {
+		case p.input <- cmd + "\n":
+		case <-p.ctx.Done():
+		}
 	}(p, cmd)
 	return nil
 }
@@ -426,22 +723,58 @@ func (p *Player) SetName(ctx context.Context, name string) {
 }
 
 // IsPassword takes an unhashed string and returns true if the input matches
-// the user password.
+// the password saved on the player. Only characters from before accounts
+// existed have a password of their own.
 func (p *Player) IsPassword(password string) bool {
-	return p.Data.Password == hashPassword(password)
+	return checkPassword(p.Data.Password, password)
+}
+
+// GetAccount returns the account the player logged in with.
+func (p *Player) GetAccount(ctx context.Context) *Account {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	return p.account
 }
 
-// SetPassword takes an unhashed string and sets that as the user password.
-func (p *Player) SetPassword(password string) {
-	p.Data.Password = hashPassword(password)
-	return
+// setAccount sets the account the player logged in with.
+func (p *Player) setAccount(ctx context.Context, a *Account) {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	p.account = a
 }
 
 // SetInterp for a player.
 func (p *Player) setInterp(ctx context.Context, i Interp) {
 	p.lock.Lock(ctx)
+	changed := p.currentInterp != i
+	entering := p.currentInterp == p.loginInterp && i != p.loginInterp
 	p.currentInterp = i
 	p.lock.Unlock(ctx)
+	if changed {
+		p.sendGMCPStatus(ctx)
+	}
+	// Clients get a full set of vitals as the player enters the world.
+	if entering {
+		p.sendGMCPVitals(ctx)
+	}
+}
+
+// interpName returns a short name for the player's current interp mode.
+func (p *Player) interpName(ctx context.Context) string {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	switch p.currentInterp {
+	case p.gameInterp:
+		return "game"
+	case p.buildInterp:
+		return "build"
+	case p.textInterp:
+		return "text"
+	case p.passwordInterp:
+		return "password"
+	default:
+		return "login"
+	}
 }
 
 // Build switches a player to the Build interp.
@@ -464,6 +797,7 @@ func (p *Player) EnableFlag(ctx context.Context, key string) {
 	p.lock.Lock(ctx)
 	defer p.lock.Unlock(ctx)
 	p.Data.Flags[key] = true
+	p.markDirty(ctx)
 }
 
 // DisableFlag disables a flag for a player.
@@ -471,6 +805,7 @@ func (p *Player) DisableFlag(ctx context.Context, key string) {
 	p.lock.Lock(ctx)
 	defer p.lock.Unlock(ctx)
 	p.Data.Flags[key] = false
+	p.markDirty(ctx)
 }
 
 // ToggleFlag will toggle the flag from it's current state, and return the new state.
@@ -478,6 +813,7 @@ func (p *Player) ToggleFlag(ctx context.Context, key string) bool {
 	p.lock.Lock(ctx)
 	defer p.lock.Unlock(ctx)
 	v, ok := p.Data.Flags[key]
+	p.markDirty(ctx)
 
 	if !ok || !v {
 		p.Data.Flags[key] = true
@@ -575,25 +911,26 @@ func (p *Player) GetStat(ctx context.Context, key string) int64 {
 
 // ModifyStat modifies a player's stat to the given number. If relative is set,
 // stat will be modified by the given value instead of set to it.
-func (p *Player) ModifyStat(key string, value int64, relative bool) {
-	switch key {
-	case "health":
-		p.Data.Stats.Health = setOrModify(p.Data.Stats.Health, value, relative)
-	case "mana":
-		p.Data.Stats.Mana = setOrModify(p.Data.Stats.Mana, value, relative)
-	case "move":
-		p.Data.Stats.Move = setOrModify(p.Data.Stats.Move, value, relative)
-	case "max_health":
-		p.Data.Stats.MaxHealth = setOrModify(p.Data.Stats.MaxHealth, value, relative)
-	case "max_mana":
-		p.Data.Stats.MaxMana = setOrModify(p.Data.Stats.MaxMana, value, relative)
-	case "max_move":
-		p.Data.Stats.MaxMove = setOrModify(p.Data.Stats.MaxMove, value, relative)
+func (p *Player) ModifyStat(ctx context.Context, key string, value int64, relative bool) {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	stat := p.Data.Stats.field(key)
+	if stat == nil {
+		return
+	}
+	old := *stat
+	*stat = setOrModify(old, value, relative)
+	if *stat != old {
+		p.sendGMCPVitals(ctx)
+		p.markDirty(ctx)
 	}
 }
 
 // PlayerDescription returns a short description of the player's state, used in `look`, etc.
 func (p *Player) PlayerDescription(ctx context.Context) string {
+	if p.IsLinkdead(ctx) {
+		return fmt.Sprintf("%s is here. (linkdead)", p.GetName(ctx))
+	}
 	return fmt.Sprintf("%s is here.", p.GetName(ctx))
 }
 
@@ -712,7 +1049,7 @@ func (p *Player) TargetPlayer(ctx context.Context, prefix, scope string) *Player
 			return nil
 		}
 
-		return room.GetPlayer(ctx, strings.Title(strings.ToLower(prefix)))
+		return room.GetPlayer(ctx, prefix)
 	default:
 		return nil
 	}
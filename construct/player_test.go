@@ -2,9 +2,13 @@ package construct
 
 import (
 	"bufio"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"testing"
 
+	"github.com/Cidan/gomud/lock"
+	"github.com/Cidan/gomud/telnet"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -89,3 +93,19 @@ func TestPlayerReconnect(t *testing.T) {
 		"quit",
 	})
 }
+
+func TestPlayerIsSecure(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	assert.False(t, isSecure(server))
+	assert.False(t, isSecure(telnet.NewConn(server)))
+
+	secure := tls.Server(server, &tls.Config{})
+	assert.True(t, isSecure(secure))
+	assert.True(t, isSecure(telnet.NewConn(secure)))
+
+	p := NewPlayer()
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+	p.SetConnection(ctx, secure)
+	assert.True(t, p.IsSecure(ctx))
+}
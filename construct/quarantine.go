@@ -0,0 +1,53 @@
+package construct
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Cidan/gomud/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// quarantineKey returns the prefix of every quarantined copy of a record.
+func quarantineKey(kind storage.Kind, key string) string {
+	return string(kind) + "." + key + "."
+}
+
+// quarantine moves a record that can't be parsed out of the way, so that
+// it isn't mistaken for a missing record and overwritten. The copy is kept
+// until an admin repairs or removes it. Returns the key of the copy.
+func quarantine(kind storage.Kind, key string, data []byte) (string, error) {
+	qkey := quarantineKey(kind, key) + time.Now().UTC().Format(backupTimeFormat)
+	if err := saveRecord(storage.Quarantine, qkey, data); err != nil {
+		return "", err
+	}
+	return qkey, deleteRecord(kind, key)
+}
+
+// quarantined returns true if a copy of the record has been quarantined.
+func quarantined(kind storage.Kind, key string) (bool, error) {
+	keys, err := recordKeys(storage.Quarantine)
+	if err != nil {
+		return false, err
+	}
+	prefix := quarantineKey(kind, key)
+	for _, k := range keys {
+		if strings.HasPrefix(k, prefix) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// reportCorrupt quarantines a record that couldn't be parsed, then logs it
+// and tells the admins in the world.
+func reportCorrupt(what string, kind storage.Kind, key string, data []byte, err error) {
+	qkey, qerr := quarantine(kind, key, data)
+	if qerr != nil {
+		log.Error().Err(qerr).Str("what", what).Msg("Unable to quarantine corrupt data.")
+		alertAdmins("{R%s is corrupt and couldn't be quarantined, see the log.{x", what)
+		return
+	}
+	log.Error().Err(err).Str("what", what).Str("quarantine", qkey).Msg("Quarantined corrupt data.")
+	alertAdmins("{R%s is corrupt and has been quarantined as %s.{x", what, qkey)
+}
@@ -0,0 +1,116 @@
+package construct
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Cidan/gomud/lock"
+	"github.com/Cidan/gomud/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// unreadableStore is a store that can't read players.
+type unreadableStore struct {
+	*storage.Memory
+}
+
+func (u unreadableStore) Get(kind storage.Kind, key string) ([]byte, error) {
+	if kind == storage.Players {
+		return nil, errors.New("permission denied")
+	}
+	return u.Memory.Get(kind, key)
+}
+
+func TestCorruptPfile(t *testing.T) {
+	testSetupWorld(t)
+	key := playerKey("Broken")
+	assert.NoError(t, saveRecord(storage.Players, key, []byte(`{"Name": "Broken", "Stats": `)))
+
+	_, found, err := loadPlayerData("Broken")
+	assert.False(t, found)
+	assert.ErrorIs(t, err, ErrCorrupt)
+
+	// The pfile is moved aside, but the name stays taken.
+	_, err = loadRecord(storage.Players, key)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	found, err = quarantined(storage.Players, key)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.True(t, characterExists("Broken"))
+}
+
+func TestNewerPfileNotQuarantined(t *testing.T) {
+	testSetupWorld(t)
+	key := playerKey("Future")
+	assert.NoError(t, saveRecord(storage.Players, key, []byte(`{"Version": 999, "Name": "Future"}`)))
+
+	_, _, err := loadPlayerData("Future")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrCorrupt)
+	_, err = loadRecord(storage.Players, key)
+	assert.NoError(t, err)
+}
+
+func TestUnreadablePfile(t *testing.T) {
+	testSetupWorld(t)
+	setStore(unreadableStore{storage.NewMemory()})
+
+	_, found, err := loadPlayerData("Anyone")
+	assert.False(t, found)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrCorrupt)
+	// A pfile that can't be read must not look like a free name.
+	assert.True(t, characterExists("Anyone"))
+}
+
+func TestLoadRoomsSkipsCorrupt(t *testing.T) {
+	testSetupWorld(t)
+	good := NewRoom()
+	good.Data.X, good.Data.Y, good.Data.Z = 9100, 0, 0
+	raw, err := json.Marshal(good.Data)
+	assert.NoError(t, err)
+	assert.NoError(t, saveRecord(storage.Rooms, good.Data.UUID, raw))
+	assert.NoError(t, saveRecord(storage.Rooms, "bad-room", []byte(`not json`)))
+
+	assert.NoError(t, LoadRooms(lock.Context(context.Background(), "test")))
+	assert.NotNil(t, Atlas.GetRoomByUUID(good.Data.UUID))
+	_, err = loadRecord(storage.Rooms, "bad-room")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	found, err := quarantined(storage.Rooms, "bad-room")
+	assert.NoError(t, err)
+	assert.True(t, found)
+}
+
+func TestLoadAreaSkipsCorruptRoom(t *testing.T) {
+	testSetupWorld(t)
+	a := NewArea("cracked", "Cracked")
+	good := NewRoom()
+	good.Data.X, good.Data.Y, good.Data.Z = 9200, 0, 0
+	good.Data.Area = a.GetID()
+	raw, err := json.Marshal(good.Data)
+	assert.NoError(t, err)
+	a.setRoom(good.Data.UUID, raw)
+	bad := NewRoom().Data.UUID
+	a.setRoom(bad, []byte(`{"UUID": "`+bad+`", "X": "east"}`))
+	assert.NoError(t, a.Save())
+
+	// The bad room is quarantined on its own, and the rest of the area
+	// still loads.
+	loaded, err := LoadArea(lock.Context(context.Background(), "test"), "cracked")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, loaded.RoomCount())
+	assert.NotNil(t, Atlas.GetRoomByUUID(good.Data.UUID))
+	assert.Nil(t, Atlas.GetRoomByUUID(bad))
+	found, err := quarantined(storage.Rooms, bad)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	found, err = quarantined(storage.Areas, "cracked")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	_, rooms, err := loadArea("cracked")
+	assert.NoError(t, err)
+	assert.Len(t, rooms, 1)
+}
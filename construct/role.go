@@ -0,0 +1,116 @@
+package construct
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/lock"
+)
+
+// role is how far a character is trusted. Every command has a role it needs,
+// and each role can do everything the roles below it can.
+type role int
+
+const (
+	rolePlayer role = iota
+	roleBuilder
+	roleAdmin
+	roleOwner
+)
+
+var roleNames = []string{"player", "builder", "admin", "owner"}
+
+// String returns the name of the role.
+func (r role) String() string {
+	if r < rolePlayer || int(r) >= len(roleNames) {
+		return fmt.Sprintf("role(%d)", int(r))
+	}
+	return roleNames[r]
+}
+
+// parseRole returns the role with the given name.
+func parseRole(name string) (role, error) {
+	for r, n := range roleNames {
+		if strings.EqualFold(n, name) {
+			return role(r), nil
+		}
+	}
+	return rolePlayer, fmt.Errorf("unknown role %s", name)
+}
+
+// MarshalText saves a role by name, so that pfiles are readable.
+func (r role) MarshalText() ([]byte, error) {
+	if r < rolePlayer || int(r) >= len(roleNames) {
+		return nil, fmt.Errorf("unknown role %d", int(r))
+	}
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText loads a role saved by name.
+func (r *role) UnmarshalText(text []byte) error {
+	parsed, err := parseRole(string(text))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// GetRole returns the player's role. The character named by the owner config
+// key is always an owner, so that a new game has someone to promote the
+// rest of the staff.
+func (p *Player) GetRole(ctx context.Context) role {
+	p.lock.Lock(ctx)
+	defer p.lock.Unlock(ctx)
+	if owner := config.GetString("owner"); owner != "" && nameKey(owner) == nameKey(p.Data.Name) {
+		return roleOwner
+	}
+	return p.Data.Role
+}
+
+// setRole sets the player's role, and drops them out of any interp they may
+// no longer use.
+func (p *Player) setRole(ctx context.Context, r role) {
+	p.lock.Lock(ctx)
+	p.Data.Role = r
+	p.lock.Unlock(ctx)
+	p.markDirty(ctx)
+	if r < roleBuilder {
+		switch p.interpName(ctx) {
+		case "build", "text":
+			p.Game(ctx)
+			p.Write(ctx, "You are no longer able to build.")
+		}
+	}
+}
+
+// alertAdmins tells every admin in the world about a problem. Problems can
+// be found with player locks held, so the admins are told from elsewhere.
+func alertAdmins(text string, args ...interface{}) {
+	msg := fmt.Sprintf(text, args...)
+	go Atlas.AllPlayers(func(p *Player) {
+		ctx := lock.Context(p.Context(), p.GetUUID(p.Context())+"alert")
+		if p.GetRole(ctx) >= roleAdmin {
+			p.Write(ctx, "%s", msg)
+		}
+	})
+}
+
+// canChangeRole returns an error if a character of role actor may not move
+// a character from role from to role to. Owners may grant any role, anyone
+// else must outrank both the character and the role they are given.
+func canChangeRole(actor, from, to role) error {
+	if actor == roleOwner {
+		return nil
+	}
+	if from >= actor {
+		return errors.New("You can't change the role of someone at your level or above.")
+	}
+	if to >= actor {
+		return errors.New("You can only grant roles below your own.")
+	}
+	return nil
+}
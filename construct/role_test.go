@@ -0,0 +1,97 @@
+package construct
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/lock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleText(t *testing.T) {
+	for _, r := range []role{rolePlayer, roleBuilder, roleAdmin, roleOwner} {
+		text, err := r.MarshalText()
+		assert.NoError(t, err)
+		var parsed role
+		assert.NoError(t, parsed.UnmarshalText(text))
+		assert.Equal(t, r, parsed)
+	}
+	_, err := parseRole("wizard")
+	assert.Error(t, err)
+
+	data, err := json.Marshal(&playerData{Role: roleBuilder})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"Role":"builder"`)
+}
+
+func TestCanChangeRole(t *testing.T) {
+	assert.NoError(t, canChangeRole(roleOwner, roleAdmin, rolePlayer))
+	assert.NoError(t, canChangeRole(roleOwner, rolePlayer, roleOwner))
+	assert.NoError(t, canChangeRole(roleAdmin, rolePlayer, roleBuilder))
+	assert.NoError(t, canChangeRole(roleAdmin, roleBuilder, rolePlayer))
+	assert.Error(t, canChangeRole(roleAdmin, rolePlayer, roleAdmin))
+	assert.Error(t, canChangeRole(roleAdmin, roleAdmin, rolePlayer))
+	assert.Error(t, canChangeRole(roleBuilder, rolePlayer, roleBuilder))
+}
+
+func TestCommandLevels(t *testing.T) {
+	testSetupWorld(t)
+	testLoginNewUser(t, "Mortal")
+	p := testFindPlayer(t, "Mortal")
+	ctx := lock.Context(p.Context(), p.Data.UUID+"test")
+
+	assert.Equal(t, rolePlayer, p.GetRole(ctx))
+	assert.Equal(t, ErrCommandNotFound, p.gameInterp.Read(ctx, "build"))
+	assert.Equal(t, ErrCommandNotFound, p.gameInterp.Read(ctx, "ban"))
+
+	p.setRole(ctx, roleBuilder)
+	assert.NoError(t, p.gameInterp.Read(ctx, "build"))
+	assert.Equal(t, "build", p.interpName(ctx))
+	assert.Equal(t, ErrCommandNotFound, p.gameInterp.Read(ctx, "ban"))
+
+	// Losing the role drops them out of the build interp.
+	p.setRole(ctx, rolePlayer)
+	assert.Equal(t, "game", p.interpName(ctx))
+
+	config.Set("owner", "mortal")
+	t.Cleanup(func() { config.Set("owner", "") })
+	assert.Equal(t, roleOwner, p.GetRole(ctx))
+}
+
+func TestPromoteDemote(t *testing.T) {
+	testSetupWorld(t)
+	testLoginNewUser(t, "Warden")
+	testLoginNewUser(t, "Novice")
+	warden := testFindPlayer(t, "Warden")
+	novice := testFindPlayer(t, "Novice")
+	ctx := lock.Context(warden.Context(), warden.Data.UUID+"test")
+	nctx := lock.Context(novice.Context(), novice.Data.UUID+"test")
+	warden.setRole(ctx, roleAdmin)
+
+	assert.NoError(t, warden.gameInterp.Read(ctx, "promote novice builder"))
+	assert.Equal(t, roleBuilder, novice.GetRole(nctx))
+
+	// Admins can't make other admins, or touch them.
+	assert.NoError(t, warden.gameInterp.Read(ctx, "promote novice admin"))
+	assert.Equal(t, roleBuilder, novice.GetRole(nctx))
+	novice.setRole(nctx, roleAdmin)
+	assert.NoError(t, warden.gameInterp.Read(ctx, "demote novice"))
+	assert.Equal(t, roleAdmin, novice.GetRole(nctx))
+	novice.setRole(nctx, roleBuilder)
+
+	assert.NoError(t, warden.gameInterp.Read(ctx, "demote novice"))
+	assert.Equal(t, rolePlayer, novice.GetRole(nctx))
+
+	// Characters that are offline are changed in their pfile.
+	novice.Stop(nctx)
+	assert.Eventually(t, func() bool {
+		return Atlas.GetPlayer("Novice") == nil
+	}, time.Second*5, time.Millisecond*10)
+	assert.NoError(t, warden.gameInterp.Read(ctx, "promote novice builder"))
+	data, found, err := loadPlayerData("Novice")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, roleBuilder, data.Role)
+}
@@ -3,15 +3,14 @@ package construct
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"math"
-	"os"
 	"strings"
 
-	"github.com/Cidan/gomud/config"
 	"github.com/Cidan/gomud/lock"
 	"github.com/Cidan/gomud/path"
+	"github.com/Cidan/gomud/storage"
 	"github.com/rs/zerolog/log"
 	uuid "github.com/satori/go.uuid"
 )
@@ -31,7 +30,9 @@ type RoomExit struct {
 // RoomData struct for a room. This data is saved to durable storage when a room is
 // saved.
 type RoomData struct {
+	Version        int
 	UUID           string
+	Area           string
 	Name           string
 	Description    string
 	X              int64
@@ -47,47 +48,51 @@ type Room struct {
 	exitRooms []*Room
 	players   map[string]*Player
 	lock      *lock.Lock
+	void      bool
 }
 
 // PlayerList is the callback function signature for listing players in a room.
 type PlayerList func(string, *Player)
 
-// LoadRooms loads all the rooms in the world.
+// LoadRooms loads all the rooms in the world. Rooms and areas that can't be
+// loaded are reported and left out, corrupt ones are quarantined.
 func LoadRooms(ctx context.Context) error {
-	os.Mkdir(fmt.Sprintf("%s/rooms", config.GetString("save_path")), 0755)
-	files, err := ioutil.ReadDir(fmt.Sprintf("%s/rooms/", config.GetString("save_path")))
+	keys, err := recordKeys(storage.Rooms)
 	if err != nil {
 		return err
 	}
-	for _, file := range files {
-		data, err := ioutil.ReadFile(fmt.Sprintf("%s/rooms/%s", config.GetString("save_path"), file.Name()))
+	for _, key := range keys {
+		// A room that can't be loaded is left out of the world, rather
+		// than keep the whole world from loading.
+		data, err := loadRecord(storage.Rooms, key)
 		if err != nil {
-			return err
+			log.Error().Err(err).Str("room", key).Msg("Unable to read room, leaving it out of the world.")
+			continue
 		}
 		room := NewRoom()
-		err = json.Unmarshal(data, &room.Data)
+		migrated, err := roomSchema.load(data, &room.Data)
+		if errors.Is(err, ErrCorrupt) {
+			reportCorrupt("Room "+key, storage.Rooms, key, data, err)
+			continue
+		}
 		if err != nil {
-			return err
+			log.Error().Err(err).Str("room", key).Msg("Unable to load room, leaving it out of the world.")
+			continue
 		}
 		log.Debug().Str("name", room.GetName()).Msg("loaded room")
 		Atlas.AddRoom(room)
-		// Save the room after load in order to apply any possible migrations.
-		if err := room.Save(); err != nil {
-			return err
-		}
-	}
-
-	// Loop through all rooms and link their exits in memory. Somewhat expensive
-	// in large worlds, but only needs to be done once. This allows for fast room
-	// movement without global lookups.
-	for _, room := range Atlas.worldMap {
-		for _, dir := range exitDirections {
-			exit := room.Exit(ctx, dir)
-			if exit.Target != "" {
-				room.exitRooms[dir] = Atlas.GetRoomByUUID(exit.Target)
+		// Rooms are only saved as they are built, so save a migrated room
+		// now rather than migrate it again on every boot.
+		if migrated {
+			if err := room.Save(); err != nil {
+				return err
 			}
 		}
 	}
+	if err := loadAreas(); err != nil {
+		return err
+	}
+	Atlas.linkExits(ctx)
 	return nil
 }
 
@@ -103,6 +108,7 @@ func NewRoom() *Room {
 	uuid := uuid.NewV4().String()
 	return &Room{
 		Data: &RoomData{
+			Version:        roomSchema.version(),
 			UUID:           uuid,
 			Name:           "New Room",
 			Description:    "This is a new room, with a new description.",
@@ -193,18 +199,29 @@ func (r *Room) GetIndex() string {
 	return fmt.Sprintf("%d,%d,%d", r.Data.X, r.Data.Y, r.Data.Z)
 }
 
-// Save a room to durable storage.
+// Save a room to durable storage. A room in an area is saved by saving the
+// whole area.
 func (r *Room) Save() error {
 	data, err := json.Marshal(r.Data)
 	if err != nil {
 		return err
 	}
-	os.Mkdir(fmt.Sprintf("%s/rooms", config.GetString("save_path")), 0755)
-	err = ioutil.WriteFile(fmt.Sprintf("%s/rooms/%s", config.GetString("save_path"), r.Data.UUID), data, 0644)
+	a, err := r.getArea()
 	if err != nil {
 		return err
 	}
-	return nil
+	if a != nil {
+		a.setRoom(r.Data.UUID, data)
+		return a.Save()
+	}
+	return saveRecord(storage.Rooms, r.Data.UUID, data)
+}
+
+// PlayerCount returns the number of players in the room.
+func (r *Room) PlayerCount(ctx context.Context) int {
+	r.lock.Lock(ctx)
+	defer r.lock.Unlock(ctx)
+	return len(r.players)
 }
 
 // LinkedRoom returns a room to which this room can traverse to using
@@ -270,8 +287,9 @@ func (r *Room) AllPlayers(ctx context.Context, fn PlayerList) {
 func (r *Room) GetPlayer(ctx context.Context, prefix string) *Player {
 	r.lock.Lock(ctx)
 	defer r.lock.Unlock(ctx)
+	prefix = nameKey(prefix)
 	for _, p := range r.players {
-		if strings.HasPrefix(p.GetName(ctx), prefix) {
+		if strings.HasPrefix(nameKey(p.GetName(ctx)), prefix) {
 			return p
 		}
 	}
@@ -0,0 +1,127 @@
+package construct
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrCorrupt is wrapped by the errors for saved data that can't be parsed,
+// as opposed to data that couldn't be read at all or is from a newer
+// version of the game.
+var ErrCorrupt = errors.New("saved data is corrupt")
+
+// migration upgrades saved data from one schema version to the next. It
+// works on the raw JSON object, so that it can see fields that no longer
+// exist in the Go struct. A migration must leave data that is already
+// upgraded as it is.
+type migration func(doc map[string]interface{}) error
+
+// schema is the ordered list of migrations for a type of saved data. Data
+// is at version n once the first n migrations have run on it, and data
+// saved before there were versions is at version 0. Migrations are only
+// ever appended, never reordered or removed.
+type schema struct {
+	name       string
+	migrations []migration
+}
+
+// version returns the version data is saved at.
+func (s *schema) version() int {
+	return len(s.migrations)
+}
+
+// upgrade runs every migration saved data hasn't had yet. Returns the data
+// unchanged and false if it is already at the current version. Data saved by
+// a newer version of the game is refused rather than risk losing what that
+// version added.
+func (s *schema) upgrade(raw []byte) ([]byte, bool, error) {
+	doc := make(map[string]interface{})
+	d := json.NewDecoder(bytes.NewReader(raw))
+	// Keep numbers as they were written, rather than round trip them
+	// through a float.
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, false, fmt.Errorf("%s: %w: %s", s.name, ErrCorrupt, err)
+	}
+	from, err := schemaVersion(doc)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w: %s", s.name, ErrCorrupt, err)
+	}
+	if from > s.version() {
+		return nil, false, fmt.Errorf("%s is saved at version %d, newer than version %d", s.name, from, s.version())
+	}
+	if from == s.version() {
+		return raw, false, nil
+	}
+	for v := from; v < s.version(); v++ {
+		if err := s.migrations[v](doc); err != nil {
+			return nil, false, fmt.Errorf("migrating %s to version %d: %w", s.name, v+1, err)
+		}
+	}
+	doc["Version"] = s.version()
+	upgraded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	log.Debug().Str("schema", s.name).Int("from", from).Int("to", s.version()).Msg("Migrated saved data.")
+	return upgraded, true, nil
+}
+
+// schemaVersion returns the version saved data is at.
+func schemaVersion(doc map[string]interface{}) (int, error) {
+	v, ok := doc["Version"]
+	if !ok || v == nil {
+		return 0, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("invalid version %v", v)
+	}
+	version, err := n.Int64()
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid version %v", v)
+	}
+	return int(version), nil
+}
+
+// load upgrades saved data and decodes it into v. Returns true if the data
+// was migrated, and should be saved again.
+func (s *schema) load(raw []byte, v interface{}) (bool, error) {
+	upgraded, migrated, err := s.upgrade(raw)
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(upgraded, v); err != nil {
+		return false, fmt.Errorf("%s: %w: %s", s.name, ErrCorrupt, err)
+	}
+	return migrated, nil
+}
+
+// playerSchema migrates saved characters.
+var playerSchema = &schema{
+	name: "player",
+	migrations: []migration{
+		// 1: The admin flag becomes the admin role.
+		func(doc map[string]interface{}) error {
+			flags, _ := doc["Flags"].(map[string]interface{})
+			if admin, _ := flags["admin"].(bool); admin {
+				r, _ := doc["Role"].(string)
+				if current, err := parseRole(r); err != nil || current < roleAdmin {
+					doc["Role"] = roleAdmin.String()
+				}
+			}
+			delete(flags, "admin")
+			return nil
+		},
+	},
+}
+
+// roomSchema migrates saved rooms.
+var roomSchema = &schema{name: "room"}
+
+// accountSchema migrates saved accounts.
+var accountSchema = &schema{name: "account"}
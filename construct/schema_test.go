@@ -0,0 +1,103 @@
+package construct
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Cidan/gomud/lock"
+	"github.com/Cidan/gomud/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaUpgrade(t *testing.T) {
+	s := &schema{
+		name: "test",
+		migrations: []migration{
+			func(doc map[string]interface{}) error {
+				if v, ok := doc["Colour"]; ok {
+					doc["Color"] = v
+					delete(doc, "Colour")
+				}
+				return nil
+			},
+			func(doc map[string]interface{}) error {
+				if _, ok := doc["Stats"]; !ok {
+					doc["Stats"] = map[string]interface{}{"Luck": 1}
+				}
+				return nil
+			},
+		},
+	}
+
+	upgraded, migrated, err := s.upgrade([]byte(`{"Colour": "red", "Gold": 9007199254740993}`))
+	assert.NoError(t, err)
+	assert.True(t, migrated)
+	assert.JSONEq(t, `{"Version": 2, "Color": "red", "Gold": 9007199254740993, "Stats": {"Luck": 1}}`, string(upgraded))
+
+	// Only the migrations data hasn't had yet are run.
+	upgraded, migrated, err = s.upgrade([]byte(`{"Version": 1, "Colour": "red"}`))
+	assert.NoError(t, err)
+	assert.True(t, migrated)
+	assert.JSONEq(t, `{"Version": 2, "Colour": "red", "Stats": {"Luck": 1}}`, string(upgraded))
+
+	current := []byte(`{"Version": 2, "Color": "blue"}`)
+	upgraded, migrated, err = s.upgrade(current)
+	assert.NoError(t, err)
+	assert.False(t, migrated)
+	assert.Equal(t, current, upgraded)
+
+	_, _, err = s.upgrade([]byte(`{"Version": 3}`))
+	assert.Error(t, err)
+	_, _, err = s.upgrade([]byte(`{"Version": "two"}`))
+	assert.Error(t, err)
+}
+
+func TestPlayerSchemaAdminFlag(t *testing.T) {
+	data := &playerData{}
+	migrated, err := playerSchema.load([]byte(`{"Name": "Old", "Flags": {"admin": true, "color": true}}`), data)
+	assert.NoError(t, err)
+	assert.True(t, migrated)
+	assert.Equal(t, playerSchema.version(), data.Version)
+	assert.Equal(t, roleAdmin, data.Role)
+	assert.False(t, data.Flags["admin"])
+	assert.True(t, data.Flags["color"])
+
+	// An owner keeps their role.
+	data = &playerData{}
+	_, err = playerSchema.load([]byte(`{"Role": "owner", "Flags": {"admin": true}}`), data)
+	assert.NoError(t, err)
+	assert.Equal(t, roleOwner, data.Role)
+}
+
+func TestLoadRoomsMigrates(t *testing.T) {
+	testSetupWorld(t)
+	migrations := roomSchema.migrations
+	t.Cleanup(func() { roomSchema.migrations = migrations })
+	roomSchema.migrations = append(migrations[:len(migrations):len(migrations)], func(doc map[string]interface{}) error {
+		doc["Description"] = "Migrated."
+		return nil
+	})
+
+	// Save a room as it was saved before there were versions.
+	room := NewRoom()
+	room.Data.Name = "Old Room"
+	room.Data.X, room.Data.Y, room.Data.Z = 900, 900, 900
+	old := make(map[string]interface{})
+	raw, err := json.Marshal(room.Data)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(raw, &old))
+	delete(old, "Version")
+	raw, err = json.Marshal(old)
+	assert.NoError(t, err)
+	assert.NoError(t, saveRecord(storage.Rooms, room.Data.UUID, raw))
+
+	assert.NoError(t, LoadRooms(lock.Context(context.Background(), "test")))
+	raw, err = loadRecord(storage.Rooms, room.Data.UUID)
+	assert.NoError(t, err)
+	data := &RoomData{}
+	assert.NoError(t, json.Unmarshal(raw, data))
+	assert.Equal(t, roomSchema.version(), data.Version)
+	assert.Equal(t, "Old Room", data.Name)
+	assert.Equal(t, "Migrated.", data.Description)
+}
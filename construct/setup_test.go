@@ -8,11 +8,22 @@ import (
 
 	"github.com/Cidan/gomud/config"
 	"github.com/Cidan/gomud/lock"
+	"github.com/Cidan/gomud/storage"
 )
 
+// testPassword is the password test characters are created with.
+const testPassword = "correct horse battery"
+
+// testCreation are the commands that pick a race, class and attributes for a
+// new character and enter the world.
+var testCreation = []string{"1", "1", "roll", "keep", "yes"}
+
 func testSetupWorld(t *testing.T) {
 	t.Helper()
 	config.Set("save_path", t.TempDir())
+	setStore(storage.NewMemory())
+	// Keep password hashing cheap, tests log in a lot.
+	config.Set("argon2_memory", 1024)
 	makeStartingRoom()
 }
 
@@ -28,17 +39,23 @@ func testLoginNewUser(t *testing.T, name string) (*bufio.Reader, *bufio.Writer)
 	reader := bufio.NewReader(client)
 	writer := bufio.NewWriter(client)
 
-	loginCommands := []string{
+	// The account and its first character share a name.
+	loginCommands := append([]string{
 		name,
 		"yes",
-		"pass",
-		"pass",
-	}
+		testPassword,
+		testPassword,
+		name,
+		"yes",
+	}, testCreation...)
 
 	// Read the login text first.
 	go func() {
 		for {
-			recv, _ := reader.ReadString('\xf9')
+			recv, err := reader.ReadString('\xf9')
+			if err != nil {
+				return
+			}
 			fmt.Printf("testLoginNewUser(): got %s\n", recv)
 		}
 	}()
@@ -75,11 +92,14 @@ func testLoginUser(t *testing.T, name string) (*bufio.Reader, *bufio.Writer) {
 
 	loginCommands := []string{
 		name,
-		"pass",
+		testPassword,
+		name,
 	}
 	go func() {
 		for {
-			reader.ReadString('\xf9')
+			if _, err := reader.ReadString('\xf9'); err != nil {
+				return
+			}
 		}
 	}()
 	// Read the login text first.
@@ -0,0 +1,139 @@
+package construct
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/Cidan/gomud/lock"
+	"github.com/rs/zerolog/log"
+)
+
+// shutdownWarnings are the points in the countdown, as time remaining, at
+// which players are warned of the shutdown.
+var shutdownWarnings = []time.Duration{
+	time.Minute * 5,
+	time.Minute,
+	time.Second * 30,
+	time.Second * 10,
+	time.Second * 5,
+	time.Second * 3,
+	time.Second * 2,
+	time.Second,
+}
+
+// AllPlayers calls fn for every player in the world. The player list is
+// copied first, so fn may add or remove players.
+func (a *AtlasData) AllPlayers(fn func(*Player)) {
+	a.allPlayersMutex.RLock()
+	var plist []*Player
+	for _, p := range a.allPlayers {
+		plist = append(plist, p)
+	}
+	a.allPlayersMutex.RUnlock()
+
+	for _, p := range plist {
+		fn(p)
+	}
+}
+
+// Broadcast writes a message to every player in the world.
+func (a *AtlasData) Broadcast(text string, args ...interface{}) {
+	a.AllPlayers(func(p *Player) {
+		ctx := lock.Context(p.Context(), p.GetUUID(p.Context())+"broadcast")
+		p.Write(ctx, text, args...)
+	})
+}
+
+// ShuttingDown returns true once a shutdown has begun, after which no new
+// logins are accepted.
+func (a *AtlasData) ShuttingDown() bool {
+	return atomic.LoadInt32(&a.shuttingDown) == 1
+}
+
+// BeginShutdown stops new logins and counts down to shutdown, warning every
+// player in the world as it goes. Canceling the context skips the rest of
+// the countdown.
+func (a *AtlasData) BeginShutdown(ctx context.Context, countdown time.Duration) {
+	atomic.StoreInt32(&a.shuttingDown, 1)
+	log.Info().Dur("countdown", countdown).Msg("Beginning shutdown countdown.")
+
+	deadline := time.Now().Add(countdown)
+	a.Broadcast("{RThe realm will shut down in %s.{x", formatCountdown(countdown))
+	for _, warning := range shutdownWarnings {
+		if warning >= countdown {
+			continue
+		}
+		select {
+		case <-time.After(time.Until(deadline.Add(-warning))):
+			a.Broadcast("{RThe realm will shut down in %s.{x", formatCountdown(warning))
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	select {
+	case <-time.After(time.Until(deadline)):
+	case <-ctx.Done():
+	}
+}
+
+// Persist saves and disconnects every player and flushes every room to
+// storage. It gives up and returns an error if this takes longer than the
+// given timeout.
+func (a *AtlasData) Persist(timeout time.Duration) error {
+	atomic.StoreInt32(&a.shuttingDown, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.AllPlayers(func(p *Player) {
+			ctx := lock.Context(p.Context(), p.GetUUID(p.Context())+"shutdown")
+			p.Write(ctx, "{RThe realm is shutting down, saving you now.{x")
+			// Stop saves the player, and reports it if the save fails.
+			p.Stop(ctx)
+		})
+		log.Info().Msg("All players saved.")
+		a.saveRooms()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("world was not persisted within %s", timeout)
+	}
+}
+
+// saveRooms writes every room in the world to storage, after anything
+// still waiting on the autosave.
+func (a *AtlasData) saveRooms() {
+	FlushDirty(0)
+	a.worldRoomMutex.RLock()
+	var rooms []*Room
+	for _, room := range a.worldRoomUUID {
+		rooms = append(rooms, room)
+	}
+	a.worldRoomMutex.RUnlock()
+	for _, room := range rooms {
+		if err := room.Save(); err != nil {
+			log.Error().Err(err).Str("room", room.Data.UUID).Msg("Unable to save room.")
+		}
+	}
+	log.Info().Int("rooms", len(rooms)).Msg("All rooms saved.")
+}
+
+// formatCountdown formats the time left in a countdown for players.
+func formatCountdown(d time.Duration) string {
+	switch {
+	case d >= time.Minute && d%time.Minute == 0:
+		if d == time.Minute {
+			return "1 minute"
+		}
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	case d <= time.Second:
+		return "1 second"
+	default:
+		return fmt.Sprintf("%d seconds", d/time.Second)
+	}
+}
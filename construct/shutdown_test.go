@@ -0,0 +1,43 @@
+package construct
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownPersistsPlayers(t *testing.T) {
+	testSetupWorld(t)
+	t.Cleanup(func() {
+		atomic.StoreInt32(&Atlas.shuttingDown, 0)
+	})
+	testLoginNewUser(t, "Shutdown")
+	assert.Eventually(t, func() bool {
+		return Atlas.GetPlayer("Shutdown") != nil
+	}, time.Second*5, time.Millisecond*10)
+
+	before, err := playerBackups("Shutdown")
+	assert.NoError(t, err)
+
+	Atlas.BeginShutdown(context.Background(), 0)
+	assert.True(t, Atlas.ShuttingDown())
+	assert.NoError(t, Atlas.Persist(time.Second*5))
+
+	assert.Nil(t, Atlas.GetPlayer("Shutdown"))
+
+	assert.True(t, characterExists("Shutdown"))
+	// The player is saved once, so only one backup is rotated in.
+	after, err := playerBackups("Shutdown")
+	assert.NoError(t, err)
+	assert.Len(t, after, len(before)+1)
+}
+
+func TestFormatCountdown(t *testing.T) {
+	assert.Equal(t, "5 minutes", formatCountdown(time.Minute*5))
+	assert.Equal(t, "1 minute", formatCountdown(time.Minute))
+	assert.Equal(t, "30 seconds", formatCountdown(time.Second*30))
+	assert.Equal(t, "1 second", formatCountdown(time.Second))
+}
@@ -0,0 +1,107 @@
+package construct
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/Cidan/gomud/config"
+	"github.com/Cidan/gomud/storage"
+)
+
+// store is where players, accounts, rooms and game records are saved. It is
+// opened from config the first time it is needed, unless set before then.
+var store = struct {
+	mutex sync.Mutex
+	s     storage.Store
+}{}
+
+// StoragePath returns where a backend keeps its data by default, under the
+// save path.
+func StoragePath(backend string) string {
+	if backend == "bolt" {
+		return filepath.Join(config.GetString("save_path"), "gomud.db")
+	}
+	return config.GetString("save_path")
+}
+
+// OpenStorage opens the backend named by the storage config key, at the
+// storage_path config key if it is set.
+func OpenStorage() error {
+	_, err := getStore()
+	return err
+}
+
+// CloseStorage closes the storage backend, if it is open.
+func CloseStorage() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.s == nil {
+		return nil
+	}
+	err := store.s.Close()
+	store.s = nil
+	return err
+}
+
+// setStore replaces the storage backend, without closing the old one.
+func setStore(s storage.Store) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.s = s
+}
+
+// getStore returns the storage backend, opening it if needed.
+func getStore() (storage.Store, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.s != nil {
+		return store.s, nil
+	}
+	backend := config.GetString("storage")
+	path := config.GetString("storage_path")
+	if path == "" {
+		path = StoragePath(backend)
+	}
+	s, err := storage.Open(backend, path)
+	if err != nil {
+		return nil, err
+	}
+	store.s = s
+	return s, nil
+}
+
+// loadRecord reads a record from storage.
+func loadRecord(kind storage.Kind, key string) ([]byte, error) {
+	s, err := getStore()
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(kind, key)
+}
+
+// saveRecord writes a record to storage.
+func saveRecord(kind storage.Kind, key string, data []byte) error {
+	s, err := getStore()
+	if err != nil {
+		return err
+	}
+	return s.Put(kind, key, data)
+}
+
+// deleteRecord removes a record from storage.
+func deleteRecord(kind storage.Kind, key string) error {
+	s, err := getStore()
+	if err != nil {
+		return err
+	}
+	return s.Delete(kind, key)
+}
+
+// recordKeys lists the records of a kind in storage.
+func recordKeys(kind storage.Kind) ([]string, error) {
+	s, err := getStore()
+	if err != nil {
+		return nil, err
+	}
+	return s.Keys(kind)
+}
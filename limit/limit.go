@@ -0,0 +1,171 @@
+// Package limit tracks failed attempts and concurrent use by key, such as an
+// IP address or an account name, to slow down brute force attacks and
+// connection floods.
+package limit
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Backoff tracks failed attempts by key. Each failure doubles how long the
+// key must wait before trying again, starting at Base and capped at Max.
+// After LockoutAfter failures in a row the key is locked out for Lockout.
+// Keys that go ResetAfter without a failure are forgotten.
+type Backoff struct {
+	Base         time.Duration
+	Max          time.Duration
+	LockoutAfter int
+	Lockout      time.Duration
+	ResetAfter   time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*backoffEntry
+	now     func() time.Time
+}
+
+type backoffEntry struct {
+	failures int
+	last     time.Time
+	next     time.Time
+}
+
+// NewBackoff creates a new backoff tracker.
+func NewBackoff(base, max time.Duration, lockoutAfter int, lockout, resetAfter time.Duration) *Backoff {
+	return &Backoff{
+		Base:         base,
+		Max:          max,
+		LockoutAfter: lockoutAfter,
+		Lockout:      lockout,
+		ResetAfter:   resetAfter,
+		entries:      make(map[string]*backoffEntry),
+		now:          time.Now,
+	}
+}
+
+// entry returns the entry for a key, forgetting it if it has gone stale.
+// Must be called with the mutex held.
+func (b *Backoff) entry(key string, now time.Time) *backoffEntry {
+	e, ok := b.entries[key]
+	if !ok {
+		return nil
+	}
+	if now.Sub(e.last) > b.ResetAfter && !now.Before(e.next) {
+		delete(b.entries, key)
+		return nil
+	}
+	return e
+}
+
+// Wait returns how long the key must wait before its next attempt, or zero
+// if it may try now.
+func (b *Backoff) Wait(key string) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.now()
+	e := b.entry(key, now)
+	if e == nil || !now.Before(e.next) {
+		return 0
+	}
+	return e.next.Sub(now)
+}
+
+// Fail records a failed attempt for the key. It returns how long the key
+// must now wait, and true if this failure locked the key out.
+func (b *Backoff) Fail(key string) (time.Duration, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.now()
+	b.prune(now)
+	e := b.entry(key, now)
+	if e == nil {
+		e = &backoffEntry{}
+		b.entries[key] = e
+	}
+	e.failures++
+	e.last = now
+
+	if b.LockoutAfter > 0 && e.failures >= b.LockoutAfter {
+		e.next = now.Add(b.Lockout)
+		// Start counting again once the lockout is over.
+		e.failures = 0
+		return b.Lockout, true
+	}
+	wait := b.Base << uint(e.failures-1)
+	if wait > b.Max || wait <= 0 {
+		wait = b.Max
+	}
+	e.next = now.Add(wait)
+	return wait, false
+}
+
+// Reset forgets all failures for the key.
+func (b *Backoff) Reset(key string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.entries, key)
+}
+
+// prune forgets every stale key. Must be called with the mutex held.
+func (b *Backoff) prune(now time.Time) {
+	for key := range b.entries {
+		b.entry(key, now)
+	}
+}
+
+// Counter counts concurrent use by key, such as open connections per IP.
+type Counter struct {
+	mutex  sync.Mutex
+	counts map[string]int
+}
+
+// NewCounter creates a new counter.
+func NewCounter() *Counter {
+	return &Counter{
+		counts: make(map[string]int),
+	}
+}
+
+// Acquire takes a slot for the key, unless it already holds max slots. A max
+// of zero or less means no limit. Returns true if a slot was taken, which
+// must be given back with Release.
+func (c *Counter) Acquire(key string, max int) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if max > 0 && c.counts[key] >= max {
+		return false
+	}
+	c.counts[key]++
+	return true
+}
+
+// Release gives back a slot taken with Acquire.
+func (c *Counter) Release(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.counts[key]--
+	if c.counts[key] <= 0 {
+		delete(c.counts, key)
+	}
+}
+
+// Count returns the number of slots held by the key.
+func (c *Counter) Count(key string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.counts[key]
+}
+
+// Host returns the host part of a network address, which is used as the key
+// for per address limits.
+func Host(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
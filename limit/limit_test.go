@@ -0,0 +1,69 @@
+package limit
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewBackoff(time.Second, time.Second*10, 5, time.Minute, time.Hour)
+	b.now = func() time.Time { return now }
+
+	assert.Zero(t, b.Wait("a"))
+	for _, want := range []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 8} {
+		wait, locked := b.Fail("a")
+		assert.Equal(t, want, wait)
+		assert.False(t, locked)
+		assert.Equal(t, want, b.Wait("a"))
+	}
+	assert.Zero(t, b.Wait("b"))
+
+	wait, locked := b.Fail("a")
+	assert.True(t, locked)
+	assert.Equal(t, time.Minute, wait)
+	now = now.Add(time.Second * 30)
+	assert.Equal(t, time.Second*30, b.Wait("a"))
+	now = now.Add(time.Second * 30)
+	assert.Zero(t, b.Wait("a"))
+
+	b.Reset("a")
+	wait, _ = b.Fail("a")
+	assert.Equal(t, time.Second, wait)
+}
+
+func TestBackoffMaxAndReset(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewBackoff(time.Second, time.Second*3, 0, 0, time.Minute)
+	b.now = func() time.Time { return now }
+	for i := 0; i < 10; i++ {
+		b.Fail("a")
+	}
+	assert.Equal(t, time.Second*3, b.Wait("a"))
+
+	// Failures are forgotten after a quiet period.
+	now = now.Add(time.Minute * 2)
+	wait, _ := b.Fail("a")
+	assert.Equal(t, time.Second, wait)
+}
+
+func TestCounter(t *testing.T) {
+	c := NewCounter()
+	assert.True(t, c.Acquire("a", 2))
+	assert.True(t, c.Acquire("a", 2))
+	assert.False(t, c.Acquire("a", 2))
+	assert.True(t, c.Acquire("b", 2))
+	c.Release("a")
+	assert.Equal(t, 1, c.Count("a"))
+	assert.True(t, c.Acquire("a", 2))
+	assert.True(t, c.Acquire("a", 0))
+}
+
+func TestHost(t *testing.T) {
+	assert.Equal(t, "10.0.0.1", Host(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 4000}))
+	assert.Equal(t, "::1", Host(&net.TCPAddr{IP: net.ParseIP("::1"), Port: 4000}))
+	assert.Equal(t, "", Host(nil))
+}
@@ -1,12 +1,15 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"time"
 
+	"github.com/Cidan/gomud/config"
 	"github.com/Cidan/gomud/construct"
+	"github.com/Cidan/gomud/limit"
 	"github.com/Cidan/gomud/lock"
-	"github.com/Cidan/gomud/util"
 
 	"github.com/rs/zerolog/log"
 )
@@ -15,49 +18,102 @@ import (
 // that handles incoming player connections.
 type Server struct {
 	listener net.Listener
+	Port     int
 }
 
 // New Server
-func New() *Server {
-	return &Server{}
+func New(port int) *Server {
+	return &Server{
+		Port: port,
+	}
 }
 
-func (s *Server) handleConnection(c net.Conn) {
-	log.Info().
-		Str("address", c.RemoteAddr().String()).
-		Msg("New connection")
+// connections counts the open connections from each address.
+var connections = limit.NewCounter()
+
+// refuse writes a message to a connection we won't serve, and closes it.
+func refuse(c net.Conn, message string) {
+	c.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	c.Write([]byte(message + "\r\n"))
+	c.Close()
+}
+
+// handleConnection creates a player for a new connection and runs it until
+// the player leaves.
+func handleConnection(c net.Conn) {
+	address := limit.Host(c.RemoteAddr())
+	if ban := construct.SiteBan(address); ban != nil {
+		log.Info().Str("address", address).Str("ban", ban.Target).Msg("Banned address refused.")
+		refuse(c, ban.Message())
+		return
+	}
+	if !connections.Acquire(address, config.GetInt("connections_per_address")) {
+		log.Warn().Str("address", address).Msg("Too many connections from address, refusing.")
+		refuse(c, "Too many connections from your address, please try again later.")
+		return
+	}
+	defer connections.Release(address)
+	if wait := construct.LoginWait(address); wait > 0 {
+		log.Info().Str("address", address).Dur("wait", wait).Msg("Address is backing off after failed logins, refusing.")
+		refuse(c, fmt.Sprintf("Too many failed logins, please try again in %s.", wait.Round(time.Second)))
+		return
+	}
+
 	p := construct.NewPlayer()
 	ctx := lock.Context(p.Context(), p.GetUUID(p.Context())+"incomming_conn")
 	p.SetConnection(ctx, c)
+	log.Info().
+		Str("address", c.RemoteAddr().String()).
+		Bool("secure", p.IsSecure(ctx)).
+		Msg("New connection")
 	// This blocks as it starts the interp loop
 	p.Start()
 }
 
-// Listen on a port for player connections.
-func (s *Server) Listen(port int) error {
-	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+// String returns the name of this server, used by the supervisor for logging.
+func (s *Server) String() string {
+	return fmt.Sprintf("server:%d", s.Port)
+}
+
+// Serve listens on the server port for player connections until the given
+// context is canceled. If accepting connections fails for any other reason,
+// the error is returned so that the supervisor can restart the listener.
+func (s *Server) Serve(ctx context.Context) error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Port))
 	if err != nil {
 		return err
 	}
 	s.listener = l
+	log.Info().Int("port", s.Port).Msg("Gomud listening for connections.")
+	return acceptConnections(ctx, l)
+}
 
-	// Handle our exit
-	go s.onSigInt()
+// acceptConnections hands every connection accepted on the listener to a new
+// player until the context is canceled, at which point the listener is
+// closed.
+func acceptConnections(ctx context.Context, l net.Listener) error {
+	// Close the listener when we're asked to stop, which breaks the
+	// accept loop below.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		l.Close()
+	}()
 
 	// Loop for new connections
 	for {
 		c, err := l.Accept()
 		if err != nil {
-			break
-		} else {
-			go s.handleConnection(c)
-			continue
+			if ctx.Err() != nil {
+				log.Info().Str("address", l.Addr().String()).Msg("Listener shutting down.")
+				return ctx.Err()
+			}
+			return err
 		}
+		go handleConnection(c)
 	}
-	return nil
-}
-
-func (s *Server) onSigInt() {
-	<-util.SigIntChannel()
-	s.listener.Close()
 }
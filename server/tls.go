@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// TLS is a network server construct that handles encrypted player
+// connections.
+type TLS struct {
+	Port       int
+	CertFile   string
+	KeyFile    string
+	SelfSigned bool
+}
+
+// NewTLS creates a TLS server for the given port, using the certificate and
+// key at the given paths. If selfSigned is set and no certificate exists, a
+// self signed certificate is generated on start.
+func NewTLS(port int, certFile, keyFile string, selfSigned bool) *TLS {
+	return &TLS{
+		Port:       port,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		SelfSigned: selfSigned,
+	}
+}
+
+// String returns the name of this server, used by the supervisor for logging.
+func (t *TLS) String() string {
+	return fmt.Sprintf("tls:%d", t.Port)
+}
+
+// Serve listens for encrypted player connections until the given context is
+// canceled.
+func (t *TLS) Serve(ctx context.Context) error {
+	cert, err := t.certificate()
+	if err != nil {
+		return err
+	}
+	l, err := tls.Listen("tcp", fmt.Sprintf(":%d", t.Port), &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		return err
+	}
+	log.Info().Int("port", t.Port).Msg("Gomud listening for TLS connections.")
+	return acceptConnections(ctx, l)
+}
+
+// certificate loads the configured certificate, generating a self signed
+// one first if allowed and none exists yet.
+func (t *TLS) certificate() (tls.Certificate, error) {
+	_, err := os.Stat(t.CertFile)
+	if os.IsNotExist(err) && t.SelfSigned {
+		log.Info().Str("cert", t.CertFile).Msg("No TLS certificate found, generating a self signed certificate.")
+		if err := generateCertificate(t.CertFile, t.KeyFile); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	return tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+}
+
+// generateCertificate writes a new self signed certificate and private key
+// to the given paths.
+func generateCertificate(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"gomud"}, CommonName: hostname},
+		DNSNames:              []string{hostname, "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := writePEM(keyFile, "EC PRIVATE KEY", keyDER, 0600); err != nil {
+		return err
+	}
+	return writePEM(certFile, "CERTIFICATE", der, 0644)
+}
+
+func writePEM(path, kind string, der []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), mode)
+}
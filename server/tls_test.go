@@ -0,0 +1,29 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	s := NewTLS(0, filepath.Join(dir, "tls", "cert.pem"), filepath.Join(dir, "tls", "key.pem"), true)
+
+	cert, err := s.certificate()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, cert.Certificate)
+
+	// The generated certificate is reused on the next start.
+	again, err := s.certificate()
+	assert.NoError(t, err)
+	assert.Equal(t, cert.Certificate, again.Certificate)
+}
+
+func TestTLSMissingCertificate(t *testing.T) {
+	dir := t.TempDir()
+	s := NewTLS(0, filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), false)
+	_, err := s.certificate()
+	assert.Error(t, err)
+}
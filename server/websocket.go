@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Cidan/gomud/telnet"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+// WebSocket is a network server construct that handles incoming player
+// connections from browser clients over WebSocket.
+type WebSocket struct {
+	Port     int
+	Path     string
+	upgrader websocket.Upgrader
+}
+
+// NewWebSocket creates a WebSocket server for the given port and path.
+func NewWebSocket(port int, path string) *WebSocket {
+	return &WebSocket{
+		Port: port,
+		Path: path,
+		upgrader: websocket.Upgrader{
+			// Browser clients may be served from anywhere, and there's no
+			// cookie based session to protect.
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// String returns the name of this server, used by the supervisor for logging.
+func (w *WebSocket) String() string {
+	return fmt.Sprintf("websocket:%d", w.Port)
+}
+
+// Serve listens for WebSocket connections until the given context is
+// canceled.
+func (w *WebSocket) Serve(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(w.Path, w.handleUpgrade)
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", w.Port),
+		Handler: mux,
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		srv.Close()
+	}()
+
+	log.Info().Int("port", w.Port).Msg("Gomud listening for websocket connections.")
+	err := srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) && ctx.Err() != nil {
+		log.Info().Int("port", w.Port).Msg("Websocket listener shutting down.")
+		return ctx.Err()
+	}
+	return err
+}
+
+func (w *WebSocket) handleUpgrade(rw http.ResponseWriter, r *http.Request) {
+	ws, err := w.upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		log.Error().Err(err).Str("address", r.RemoteAddr).Msg("Unable to upgrade websocket connection.")
+		return
+	}
+	handleConnection(newWSConn(ws))
+}
+
+// wsConn adapts a WebSocket to a net.Conn, so that players can use it like
+// any other connection. Each text frame read is one line of input, and all
+// telnet commands are removed from output.
+type wsConn struct {
+	ws     *websocket.Conn
+	buffer []byte
+	wmutex sync.Mutex
+}
+
+func newWSConn(ws *websocket.Conn) *wsConn {
+	return &wsConn{ws: ws}
+}
+
+// Read reads input from the client, one frame at a time.
+func (c *wsConn) Read(b []byte) (int, error) {
+	for len(c.buffer) == 0 {
+		kind, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		if kind != websocket.TextMessage && kind != websocket.BinaryMessage {
+			continue
+		}
+		// A frame is a whole line of input, terminate it for the scanner.
+		if !bytes.HasSuffix(data, []byte("\n")) {
+			data = append(data, '\n')
+		}
+		c.buffer = data
+	}
+	n := copy(b, c.buffer)
+	c.buffer = c.buffer[n:]
+	return n, nil
+}
+
+// Write sends output to the client as a text frame, with any telnet
+// commands, such as negotiation and prompt markers, removed.
+func (c *wsConn) Write(b []byte) (int, error) {
+	data := telnet.StripCommands(b)
+	if len(data) == 0 {
+		return len(b), nil
+	}
+	c.wmutex.Lock()
+	defer c.wmutex.Unlock()
+	if err := c.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Secure returns true if the websocket was served over TLS.
+func (c *wsConn) Secure() bool {
+	_, ok := c.ws.UnderlyingConn().(*tls.Conn)
+	return ok
+}
+
+func (c *wsConn) Close() error {
+	return c.ws.Close()
+}
+
+func (c *wsConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+func (c *wsConn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
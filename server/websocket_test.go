@@ -0,0 +1,42 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebSocketConn(t *testing.T) {
+	w := NewWebSocket(0, "/")
+	lines := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ws, err := w.upgrader.Upgrade(rw, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		c := newWSConn(ws)
+		defer c.Close()
+		c.Write([]byte("\xff\xfb\x01Password: \r\xff\xf9"))
+		line, err := bufio.NewReader(c).ReadString('\n')
+		assert.NoError(t, err)
+		lines <- line
+	}))
+	defer srv.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	kind, data, err := client.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, websocket.TextMessage, kind)
+	assert.Equal(t, "Password: \r", string(data))
+
+	assert.NoError(t, client.WriteMessage(websocket.TextMessage, []byte("secret")))
+	assert.Equal(t, "secret\n", <-lines)
+}
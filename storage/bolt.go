@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bolt keeps records in a single embedded database file, with a bucket for
+// each kind.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// NewBolt opens or creates a bolt database. Only one process may have the
+// database open, so this fails rather than waiting if the game is running.
+func NewBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, kind := range Kinds {
+			if _, err := tx.CreateBucketIfNotExists([]byte(kind)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+// bucket returns the bucket for a kind, creating it if needed in a writable
+// transaction.
+func bucket(tx *bolt.Tx, kind Kind) (*bolt.Bucket, error) {
+	if b := tx.Bucket([]byte(kind)); b != nil || !tx.Writable() {
+		return b, nil
+	}
+	return tx.CreateBucket([]byte(kind))
+}
+
+// Get returns a record.
+func (b *Bolt) Get(kind Kind, key string) ([]byte, error) {
+	var data []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt, _ := bucket(tx, kind)
+		if bkt == nil {
+			return ErrNotFound
+		}
+		value := bkt.Get([]byte(key))
+		if value == nil {
+			return ErrNotFound
+		}
+		// Values are only valid for the life of the transaction.
+		data = append([]byte(nil), value...)
+		return nil
+	})
+	return data, err
+}
+
+// Put saves a record.
+func (b *Bolt) Put(kind Kind, key string, data []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := bucket(tx, kind)
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(key), data)
+	})
+}
+
+// Delete removes a record.
+func (b *Bolt) Delete(kind Kind, key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := bucket(tx, kind)
+		if err != nil {
+			return err
+		}
+		return bkt.Delete([]byte(key))
+	})
+}
+
+// Keys returns the keys of a kind in sorted order.
+func (b *Bolt) Keys(kind Kind) ([]string, error) {
+	var keys []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt, _ := bucket(tx, kind)
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// Close closes the database.
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
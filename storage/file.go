@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// File keeps each record in its own file under a root directory. Players
+// sit in the root itself, accounts and rooms in their own directories, and
+// game records in the root as json files.
+type File struct {
+	root string
+}
+
+// NewFile creates a file store under the given directory, creating it if
+// needed.
+func NewFile(root string) (*File, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &File{root: root}, nil
+}
+
+// dir returns the directory records of a kind are kept in.
+func (f *File) dir(kind Kind) string {
+	switch kind {
+	case Players, Game:
+		return f.root
+	}
+	return filepath.Join(f.root, string(kind))
+}
+
+// path returns the file a record is kept in.
+func (f *File) path(kind Kind, key string) string {
+	if kind == Game {
+		key += ".json"
+	}
+	return filepath.Join(f.dir(kind), key)
+}
+
+// Get reads a record.
+func (f *File) Get(kind Kind, key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(f.path(kind, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Put writes a record. The record is written to a temporary file which is
+// renamed over the old one, so a crash part way through leaves the old
+// record intact.
+func (f *File) Put(kind Kind, key string, data []byte) error {
+	if err := os.MkdirAll(f.dir(kind), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path(kind, key), data, 0644)
+}
+
+// writeFileAtomic writes data to a temporary file next to path, syncs it to
+// disk and renames it into place.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	// Clean up the temporary file if anything fails before the rename.
+	renamed := false
+	defer func() {
+		if !renamed {
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	renamed = true
+	// Sync the directory too, or the rename itself may be lost in a crash.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Delete removes a record.
+func (f *File) Delete(kind Kind, key string) error {
+	err := os.Remove(f.path(kind, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Keys lists the records of a kind. Players share the root directory with
+// everything else, so only files named by a UUID are players.
+func (f *File) Keys(kind Kind) ([]string, error) {
+	entries, err := ioutil.ReadDir(f.dir(kind))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, entry := range entries {
+		name := entry.Name()
+		// Hidden files are temporary files from saves in progress.
+		if !entry.Mode().IsRegular() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		switch kind {
+		case Players:
+			if _, err := uuid.FromString(name); err != nil {
+				continue
+			}
+		case Game:
+			if !strings.HasSuffix(name, ".json") {
+				continue
+			}
+			name = strings.TrimSuffix(name, ".json")
+		}
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Close does nothing, files are closed as soon as they are written.
+func (f *File) Close() error {
+	return nil
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+)
+
+// Memory keeps records in memory. Nothing survives a restart, so it is
+// only useful for tests.
+type Memory struct {
+	mutex   sync.RWMutex
+	records map[Kind]map[string][]byte
+}
+
+// NewMemory creates an empty memory store.
+func NewMemory() *Memory {
+	return &Memory{records: make(map[Kind]map[string][]byte)}
+}
+
+// Get returns a copy of a record.
+func (m *Memory) Get(kind Kind, key string) ([]byte, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	data, ok := m.records[kind][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Put saves a copy of a record.
+func (m *Memory) Put(kind Kind, key string, data []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.records[kind] == nil {
+		m.records[kind] = make(map[string][]byte)
+	}
+	m.records[kind][key] = append([]byte(nil), data...)
+	return nil
+}
+
+// Delete removes a record.
+func (m *Memory) Delete(kind Kind, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.records[kind], key)
+	return nil
+}
+
+// Keys returns the keys of a kind in sorted order.
+func (m *Memory) Keys(kind Kind) ([]string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	keys := make([]string, 0, len(m.records[kind]))
+	for key := range m.records[kind] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Close does nothing, the records are kept until the store is dropped.
+func (m *Memory) Close() error {
+	return nil
+}
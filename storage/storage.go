@@ -0,0 +1,93 @@
+// Package storage saves and loads the game's data. Data is stored as raw
+// records, grouped by kind and looked up by key, so that the game doesn't
+// care whether it lives in files, an embedded database or memory.
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when a record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// Kind is a group of records of the same type.
+type Kind string
+
+const (
+	// Players are characters, keyed by a UUID derived from their name.
+	Players Kind = "players"
+	// Accounts are keyed by their UUID.
+	Accounts Kind = "accounts"
+	// Rooms are keyed by their UUID. Rooms in an area are saved with the
+	// area instead.
+	Rooms Kind = "rooms"
+	// Areas hold an area and all of its rooms, keyed by the area ID.
+	Areas Kind = "areas"
+	// Game holds records there is only one of, such as the ban list.
+	Game Kind = "game"
+	// Backups are old copies of other records.
+	Backups Kind = "backups"
+	// Quarantine holds records that couldn't be parsed, moved aside so an
+	// admin can repair them.
+	Quarantine Kind = "quarantine"
+)
+
+// Kinds are all the kinds of record, in the order they are migrated.
+var Kinds = []Kind{Players, Accounts, Rooms, Areas, Game, Backups, Quarantine}
+
+// Store is a storage backend.
+type Store interface {
+	// Get returns a record, or ErrNotFound if it doesn't exist.
+	Get(kind Kind, key string) ([]byte, error)
+	// Put saves a record, replacing any record with the same key.
+	Put(kind Kind, key string, data []byte) error
+	// Delete removes a record. Removing a record that doesn't exist is
+	// not an error.
+	Delete(kind Kind, key string) error
+	// Keys returns the key of every record of a kind.
+	Keys(kind Kind) ([]string, error)
+	// Close releases the backend.
+	Close() error
+}
+
+// Backends are the names of the storage backends that can be opened.
+var Backends = []string{"file", "bolt", "memory"}
+
+// Open opens a storage backend by name. The path is the directory files are
+// kept under for the file backend, and the database file for the bolt
+// backend. The memory backend ignores it.
+func Open(backend, path string) (Store, error) {
+	switch backend {
+	case "file":
+		return NewFile(path)
+	case "bolt":
+		return NewBolt(path)
+	case "memory":
+		return NewMemory(), nil
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", backend)
+}
+
+// Copy copies every record from one store to another, overwriting any
+// record already in the destination. Returns the number of records copied.
+func Copy(dst, src Store) (int, error) {
+	var copied int
+	for _, kind := range Kinds {
+		keys, err := src.Keys(kind)
+		if err != nil {
+			return copied, fmt.Errorf("listing %s: %w", kind, err)
+		}
+		for _, key := range keys {
+			data, err := src.Get(kind, key)
+			if err != nil {
+				return copied, fmt.Errorf("reading %s %s: %w", kind, key, err)
+			}
+			if err := dst.Put(kind, key, data); err != nil {
+				return copied, fmt.Errorf("writing %s %s: %w", kind, key, err)
+			}
+			copied++
+		}
+	}
+	return copied, nil
+}
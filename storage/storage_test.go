@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testStores opens one of every backend.
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	stores := make(map[string]Store)
+	for _, backend := range Backends {
+		path := t.TempDir()
+		if backend == "bolt" {
+			path = filepath.Join(path, "gomud.db")
+		}
+		s, err := Open(backend, path)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		t.Cleanup(func() { s.Close() })
+		stores[backend] = s
+	}
+	return stores
+}
+
+func TestStore(t *testing.T) {
+	for backend, s := range testStores(t) {
+		t.Run(backend, func(t *testing.T) {
+			_, err := s.Get(Players, "missing")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			id := "6ba7b812-9dad-11d1-80b4-00c04fd430c8"
+			assert.NoError(t, s.Put(Players, id, []byte(`{"Name":"Bob"}`)))
+			assert.NoError(t, s.Put(Rooms, "b", []byte("room b")))
+			assert.NoError(t, s.Put(Rooms, "a", []byte("room a")))
+			assert.NoError(t, s.Put(Game, "bans", []byte("[]")))
+
+			data, err := s.Get(Players, id)
+			assert.NoError(t, err)
+			assert.Equal(t, `{"Name":"Bob"}`, string(data))
+
+			keys, err := s.Keys(Players)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{id}, keys)
+			keys, err = s.Keys(Rooms)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"a", "b"}, keys)
+			keys, err = s.Keys(Game)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"bans"}, keys)
+			keys, err = s.Keys(Accounts)
+			assert.NoError(t, err)
+			assert.Empty(t, keys)
+
+			assert.NoError(t, s.Put(Rooms, "a", []byte("new room a")))
+			data, err = s.Get(Rooms, "a")
+			assert.NoError(t, err)
+			assert.Equal(t, "new room a", string(data))
+
+			assert.NoError(t, s.Delete(Rooms, "a"))
+			assert.NoError(t, s.Delete(Rooms, "a"))
+			_, err = s.Get(Rooms, "a")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestCopy(t *testing.T) {
+	stores := testStores(t)
+	src, dst := stores["file"], stores["bolt"]
+	assert.NoError(t, src.Put(Accounts, "one", []byte("account")))
+	assert.NoError(t, src.Put(Rooms, "two", []byte("room")))
+	assert.NoError(t, src.Put(Game, "reserved_names", []byte("[]")))
+
+	copied, err := Copy(dst, src)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, copied)
+	data, err := dst.Get(Rooms, "two")
+	assert.NoError(t, err)
+	assert.Equal(t, "room", string(data))
+}
+
+func TestOpenUnknown(t *testing.T) {
+	_, err := Open("floppy", t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestFileLayout(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewFile(root)
+	assert.NoError(t, err)
+	id := "6ba7b812-9dad-11d1-80b4-00c04fd430c8"
+	assert.NoError(t, s.Put(Players, id, []byte("{}")))
+	assert.NoError(t, s.Put(Accounts, "acct", []byte("{}")))
+	assert.NoError(t, s.Put(Rooms, "room", []byte("{}")))
+	assert.NoError(t, s.Put(Game, "bans", []byte("[]")))
+	for _, path := range []string{id, "accounts/acct", "rooms/room", "bans.json"} {
+		assert.FileExists(t, filepath.Join(root, path))
+	}
+}
+
+func TestFileAtomicPut(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewFile(root)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Put(Rooms, "room", []byte("old")))
+	assert.NoError(t, s.Put(Rooms, "room", []byte("new")))
+
+	// A temporary file left by a crash is not a record.
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "rooms", ".room.tmp123"), []byte("half"), 0644))
+	keys, err := s.Keys(Rooms)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"room"}, keys)
+	data, err := s.Get(Rooms, "room")
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+}
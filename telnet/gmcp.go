@@ -0,0 +1,28 @@
+package telnet
+
+import (
+	"bytes"
+	"strings"
+)
+
+// SendGMCP sends a GMCP message with an already encoded JSON payload. The
+// payload may be empty for messages that carry no data.
+func (c *Conn) SendGMCP(message string, payload []byte) error {
+	data := []byte(message)
+	if len(payload) > 0 {
+		data = append(data, ' ')
+		data = append(data, payload...)
+	}
+	return c.Subnegotiate(OptGMCP, data)
+}
+
+// ParseGMCP splits a GMCP subnegotiation into the message name and the JSON
+// payload, if any.
+func ParseGMCP(data []byte) (string, []byte) {
+	data = bytes.TrimSpace(data)
+	i := bytes.IndexAny(data, " \t\n")
+	if i < 0 {
+		return string(data), nil
+	}
+	return strings.TrimSpace(string(data[:i])), bytes.TrimSpace(data[i+1:])
+}
@@ -0,0 +1,63 @@
+package telnet
+
+import "compress/zlib"
+
+// flushWriter flushes the zlib stream after every write so that output is
+// never held back waiting for more data.
+type flushWriter struct {
+	z *zlib.Writer
+}
+
+func (f *flushWriter) Write(b []byte) (int, error) {
+	n, err := f.z.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, f.z.Flush()
+}
+
+// startCompression starts MCCP2 compression of everything we send. The
+// start marker itself is the last thing the client reads uncompressed.
+func (c *Conn) startCompression() error {
+	c.wmutex.Lock()
+	defer c.wmutex.Unlock()
+	if c.zlib != nil {
+		return nil
+	}
+	if _, err := c.Conn.Write([]byte{IAC, SB, OptMCCP2, IAC, SE}); err != nil {
+		return err
+	}
+	c.zlib = zlib.NewWriter(c.Conn)
+	c.writer = &flushWriter{c.zlib}
+	return nil
+}
+
+// stopCompression ends the compressed stream, after which the client reads
+// uncompressed data again.
+func (c *Conn) stopCompression() error {
+	c.wmutex.Lock()
+	defer c.wmutex.Unlock()
+	if c.zlib == nil {
+		return nil
+	}
+	err := c.zlib.Close()
+	c.zlib = nil
+	c.writer = c.Conn
+	return err
+}
+
+// SetCompression turns MCCP2 compression on or off for this connection. The
+// client must still agree to compression before it starts.
+func (c *Conn) SetCompression(on bool) error {
+	if on {
+		return c.EnableLocal(OptMCCP2)
+	}
+	return c.DisableLocal(OptMCCP2)
+}
+
+// Compressing returns true if output is currently being compressed.
+func (c *Conn) Compressing() bool {
+	c.wmutex.Lock()
+	defer c.wmutex.Unlock()
+	return c.zlib != nil
+}
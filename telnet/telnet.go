@@ -0,0 +1,651 @@
+// Package telnet implements the telnet protocol layer between a player
+// socket and the game. It strips and answers option negotiation so that
+// only plain text reaches the interp, and tracks the options a client has
+// agreed to.
+package telnet
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Telnet commands.
+const (
+	EOR  byte = 239
+	SE   byte = 240
+	NOP  byte = 241
+	GA   byte = 249
+	SB   byte = 250
+	WILL byte = 251
+	WONT byte = 252
+	DO   byte = 253
+	DONT byte = 254
+	IAC  byte = 255
+)
+
+// Telnet options.
+const (
+	OptEcho  byte = 1
+	OptSGA   byte = 3
+	OptTTYPE byte = 24
+	OptEOR   byte = 25
+	OptNAWS  byte = 31
+	OptMCCP2 byte = 86
+	OptGMCP  byte = 201
+)
+
+// TTYPE subnegotiation commands.
+const (
+	ttypeIS   byte = 0
+	ttypeSEND byte = 1
+)
+
+// maxTTYPERequests is the number of times we'll cycle the terminal type of a
+// client. MTTS clients report their client name, terminal type, and then the
+// MTTS bit vector.
+const maxTTYPERequests = 3
+
+// maxSubnegotiation caps the size of a single subnegotiation so a broken
+// client can't grow our buffer forever.
+const maxSubnegotiation = 8192
+
+// localOptions are the options we are willing to enable on our side. A value
+// of false means we only enable the option when we asked for it first.
+var localOptions = map[byte]bool{
+	OptSGA:   true,
+	OptEOR:   true,
+	OptEcho:  false,
+	OptGMCP:  true,
+	OptMCCP2: true,
+}
+
+// remoteOptions are the options we are willing to let the client enable.
+var remoteOptions = map[byte]bool{
+	OptNAWS:  true,
+	OptTTYPE: true,
+}
+
+// parser states
+const (
+	stateData = iota
+	stateIAC
+	stateOption
+	stateSB
+	stateSBData
+	stateSBIAC
+	stateCR
+)
+
+// SubnegotiationFn is the callback signature for handling a subnegotiation
+// from the client. data does not include the option byte.
+type SubnegotiationFn func(data []byte)
+
+// OptionFn is the callback signature for being notified of an option
+// changing state. local is true when the option is on our side of the
+// connection.
+type OptionFn func(opt byte, local, enabled bool)
+
+// State is a snapshot of the negotiated state of a connection.
+type State struct {
+	SGA      bool
+	EOR      bool
+	Echo     bool
+	NAWS     bool
+	GMCP     bool
+	MCCP     bool
+	Width    int
+	Height   int
+	Client   string
+	Terminal string
+	MTTS     int
+}
+
+// Conn is a telnet connection. Reads return the data stream with all
+// telnet commands removed, and negotiation is answered as it arrives.
+// Writes are sent as is, callers are expected to only write text; valid
+// UTF-8 can never contain an IAC byte.
+type Conn struct {
+	net.Conn
+	writer io.Writer
+	zlib   *zlib.Writer
+	wmutex sync.Mutex
+
+	mutex  sync.RWMutex
+	local  map[byte]bool
+	remote map[byte]bool
+	// askedLocal holds the state we last asked the client for, for each
+	// option still waiting on a reply. wantLocal is the state we want
+	// the option to end up in, which is asked for again once the reply
+	// arrives if it changed in the meantime.
+	askedLocal    map[byte]bool
+	wantLocal     map[byte]bool
+	pendingRemote map[byte]bool
+	subHandlers   map[byte]SubnegotiationFn
+	optHandlers   []OptionFn
+	width         int
+	height        int
+	ttypes        []string
+	mtts          int
+
+	// parser state, only touched by the reader.
+	rbuf   []byte
+	out    []byte
+	state  int
+	cmd    byte
+	sbOpt  byte
+	sbData []byte
+}
+
+// NewConn wraps a network connection in a telnet connection.
+func NewConn(c net.Conn) *Conn {
+	return &Conn{
+		Conn:          c,
+		writer:        c,
+		local:         make(map[byte]bool),
+		remote:        make(map[byte]bool),
+		askedLocal:    make(map[byte]bool),
+		wantLocal:     make(map[byte]bool),
+		pendingRemote: make(map[byte]bool),
+		subHandlers:   make(map[byte]SubnegotiationFn),
+		rbuf:          make([]byte, 4096),
+	}
+}
+
+// Negotiate sends our initial option offers to the client.
+func (c *Conn) Negotiate() error {
+	if err := c.EnableLocal(OptSGA); err != nil {
+		return err
+	}
+	if err := c.EnableLocal(OptEOR); err != nil {
+		return err
+	}
+	if err := c.EnableLocal(OptMCCP2); err != nil {
+		return err
+	}
+	if err := c.EnableLocal(OptGMCP); err != nil {
+		return err
+	}
+	if err := c.EnableRemote(OptNAWS); err != nil {
+		return err
+	}
+	return c.EnableRemote(OptTTYPE)
+}
+
+// Read reads data from the connection with all telnet commands removed.
+func (c *Conn) Read(b []byte) (int, error) {
+	for len(c.out) == 0 {
+		n, err := c.Conn.Read(c.rbuf)
+		c.parse(c.rbuf[:n])
+		if err != nil {
+			if len(c.out) == 0 {
+				return 0, err
+			}
+			break
+		}
+	}
+	n := copy(b, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+// Write writes data to the connection.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.wmutex.Lock()
+	defer c.wmutex.Unlock()
+	return c.writer.Write(b)
+}
+
+// SendCommand writes a raw telnet command sequence to the client.
+func (c *Conn) SendCommand(cmd ...byte) error {
+	_, err := c.Write(append([]byte{IAC}, cmd...))
+	return err
+}
+
+// Subnegotiate sends a subnegotiation for the given option to the client.
+// IAC bytes in data are escaped.
+func (c *Conn) Subnegotiate(opt byte, data []byte) error {
+	buf := []byte{IAC, SB, opt}
+	for _, b := range data {
+		if b == IAC {
+			buf = append(buf, IAC)
+		}
+		buf = append(buf, b)
+	}
+	buf = append(buf, IAC, SE)
+	_, err := c.Write(buf)
+	return err
+}
+
+// HandleSubnegotiation registers a callback for subnegotiations of the
+// given option.
+func (c *Conn) HandleSubnegotiation(opt byte, fn SubnegotiationFn) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.subHandlers[opt] = fn
+}
+
+// HandleOption registers a callback for option state changes.
+func (c *Conn) HandleOption(fn OptionFn) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.optHandlers = append(c.optHandlers, fn)
+}
+
+// EnableLocal asks the client to let us enable an option. If the client
+// has yet to answer an earlier request for the option, this one is sent
+// once it does.
+func (c *Conn) EnableLocal(opt byte) error {
+	c.mutex.Lock()
+	c.wantLocal[opt] = true
+	if _, pending := c.askedLocal[opt]; pending || c.local[opt] {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.askedLocal[opt] = true
+	c.mutex.Unlock()
+	return c.SendCommand(WILL, opt)
+}
+
+// DisableLocal tells the client we are disabling an option. If the client
+// has yet to answer an earlier request for the option, this one is sent
+// once it does.
+func (c *Conn) DisableLocal(opt byte) error {
+	c.mutex.Lock()
+	c.wantLocal[opt] = false
+	if _, pending := c.askedLocal[opt]; pending || !c.local[opt] {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.local[opt] = false
+	c.askedLocal[opt] = false
+	c.mutex.Unlock()
+	if err := c.optionChanged(opt, true, false); err != nil {
+		return err
+	}
+	c.notify(opt, true, false)
+	return c.SendCommand(WONT, opt)
+}
+
+// EnableRemote asks the client to enable an option.
+func (c *Conn) EnableRemote(opt byte) error {
+	c.mutex.Lock()
+	if c.remote[opt] || c.pendingRemote[opt] {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.pendingRemote[opt] = true
+	c.mutex.Unlock()
+	return c.SendCommand(DO, opt)
+}
+
+// LocalEnabled returns true if an option is enabled on our side.
+func (c *Conn) LocalEnabled(opt byte) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.local[opt]
+}
+
+// RemoteEnabled returns true if the client has enabled an option.
+func (c *Conn) RemoteEnabled(opt byte) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.remote[opt]
+}
+
+// SetEcho controls whether the client should echo typed input locally.
+// Disabling echo is used to hide passwords as they are typed.
+func (c *Conn) SetEcho(on bool) error {
+	if on {
+		return c.DisableLocal(OptEcho)
+	}
+	return c.EnableLocal(OptEcho)
+}
+
+// PromptEnd returns the sequence that marks the end of a prompt, EOR if
+// the client negotiated it, otherwise GA unless go ahead was suppressed.
+func (c *Conn) PromptEnd() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	switch {
+	case c.local[OptEOR]:
+		return string([]byte{IAC, EOR})
+	case c.local[OptSGA]:
+		return ""
+	default:
+		return string([]byte{IAC, GA})
+	}
+}
+
+// State returns a snapshot of the negotiated state of this connection.
+func (c *Conn) State() State {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	s := State{
+		SGA:    c.local[OptSGA],
+		EOR:    c.local[OptEOR],
+		Echo:   !c.local[OptEcho],
+		NAWS:   c.remote[OptNAWS],
+		GMCP:   c.local[OptGMCP],
+		MCCP:   c.local[OptMCCP2],
+		Width:  c.width,
+		Height: c.height,
+		MTTS:   c.mtts,
+	}
+	if len(c.ttypes) > 0 {
+		s.Client = c.ttypes[0]
+	}
+	if len(c.ttypes) > 1 {
+		s.Terminal = c.ttypes[1]
+	}
+	return s
+}
+
+// Restore marks options as already enabled from a previous snapshot of the
+// connection, without negotiating them again. This is used to pick a
+// connection back up after it has been handed to a new process, where the
+// client still believes the old options are in effect. Compression is never
+// restored, as the compressed stream can't be resumed.
+func (c *Conn) Restore(s State) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.local[OptSGA] = s.SGA
+	c.local[OptEOR] = s.EOR
+	c.local[OptEcho] = !s.Echo
+	c.local[OptGMCP] = s.GMCP
+	c.remote[OptNAWS] = s.NAWS
+	c.width = s.Width
+	c.height = s.Height
+	c.mtts = s.MTTS
+	c.ttypes = nil
+	if s.Client != "" {
+		c.remote[OptTTYPE] = true
+		c.ttypes = append(c.ttypes, s.Client)
+		if s.Terminal != "" {
+			c.ttypes = append(c.ttypes, s.Terminal)
+		}
+	}
+}
+
+// parse runs raw bytes from the socket through the telnet state machine,
+// appending plain data to the output buffer.
+func (c *Conn) parse(data []byte) {
+	for _, b := range data {
+		switch c.state {
+		case stateData:
+			switch b {
+			case IAC:
+				c.state = stateIAC
+			case '\r':
+				c.out = append(c.out, b)
+				c.state = stateCR
+			default:
+				c.out = append(c.out, b)
+			}
+		case stateCR:
+			// CR NUL is a bare carriage return, drop the NUL.
+			c.state = stateData
+			switch b {
+			case 0:
+			case IAC:
+				c.state = stateIAC
+			default:
+				c.out = append(c.out, b)
+			}
+		case stateIAC:
+			switch b {
+			case IAC:
+				// Escaped 255 data byte.
+				c.out = append(c.out, b)
+				c.state = stateData
+			case WILL, WONT, DO, DONT:
+				c.cmd = b
+				c.state = stateOption
+			case SB:
+				c.state = stateSB
+			default:
+				// GA, NOP and friends carry no meaning for us.
+				c.state = stateData
+			}
+		case stateOption:
+			c.handleNegotiation(c.cmd, b)
+			c.state = stateData
+		case stateSB:
+			c.sbOpt = b
+			c.sbData = c.sbData[:0]
+			c.state = stateSBData
+		case stateSBData:
+			if b == IAC {
+				c.state = stateSBIAC
+				continue
+			}
+			if len(c.sbData) < maxSubnegotiation {
+				c.sbData = append(c.sbData, b)
+			}
+		case stateSBIAC:
+			switch b {
+			case SE:
+				c.handleSubnegotiation(c.sbOpt, c.sbData)
+				c.state = stateData
+			case IAC:
+				if len(c.sbData) < maxSubnegotiation {
+					c.sbData = append(c.sbData, b)
+				}
+				c.state = stateSBData
+			default:
+				// Malformed subnegotiation, drop it.
+				c.state = stateData
+			}
+		}
+	}
+}
+
+// handleNegotiation answers an option negotiation from the client, taking
+// care to never reply to an answer of our own request, which would loop.
+func (c *Conn) handleNegotiation(cmd, opt byte) {
+	var reply []byte
+	var changed, local, enabled bool
+
+	c.mutex.Lock()
+	switch cmd {
+	case DO:
+		asked, pending := c.askedLocal[opt]
+		delete(c.askedLocal, opt)
+		unsolicited, ok := localOptions[opt]
+		accept := ok && (pending || unsolicited)
+		switch {
+		case pending && !asked:
+			// The client should have agreed to our WONT. Take it that it
+			// did, and ask again if we have since changed our mind.
+			if c.wantLocal[opt] {
+				c.askedLocal[opt] = true
+				reply = []byte{IAC, WILL, opt}
+			}
+		case !accept:
+			reply = []byte{IAC, WONT, opt}
+		case pending && !c.wantLocal[opt]:
+			// The option was disabled while we waited on the client.
+			c.askedLocal[opt] = false
+			reply = []byte{IAC, WONT, opt}
+		case !c.local[opt]:
+			c.local[opt] = true
+			changed, local, enabled = true, true, true
+			if !pending {
+				reply = []byte{IAC, WILL, opt}
+			}
+		}
+	case DONT:
+		asked, pending := c.askedLocal[opt]
+		delete(c.askedLocal, opt)
+		if c.local[opt] {
+			c.local[opt] = false
+			changed, local, enabled = true, true, false
+			if !pending {
+				reply = []byte{IAC, WONT, opt}
+			}
+		}
+		if pending && !asked && c.wantLocal[opt] {
+			// The option was enabled again while we waited on the client.
+			// A DONT to our WILL is a refusal, and isn't asked again.
+			c.askedLocal[opt] = true
+			reply = []byte{IAC, WILL, opt}
+		}
+	case WILL:
+		pending := c.pendingRemote[opt]
+		c.pendingRemote[opt] = false
+		switch {
+		case !remoteOptions[opt]:
+			reply = []byte{IAC, DONT, opt}
+		case !c.remote[opt]:
+			c.remote[opt] = true
+			changed, local, enabled = true, false, true
+			if !pending {
+				reply = []byte{IAC, DO, opt}
+			}
+		}
+	case WONT:
+		pending := c.pendingRemote[opt]
+		c.pendingRemote[opt] = false
+		if c.remote[opt] {
+			c.remote[opt] = false
+			changed, local, enabled = true, false, false
+			if !pending {
+				reply = []byte{IAC, DONT, opt}
+			}
+		}
+	}
+	c.mutex.Unlock()
+
+	if reply != nil {
+		c.Write(reply)
+	}
+	if !changed {
+		return
+	}
+
+	c.optionChanged(opt, local, enabled)
+	c.notify(opt, local, enabled)
+}
+
+// optionChanged applies the side effects of an option changing state.
+func (c *Conn) optionChanged(opt byte, local, enabled bool) error {
+	switch {
+	case opt == OptTTYPE && !local && enabled:
+		// Ask for the terminal type as soon as the client agrees to send it.
+		return c.Subnegotiate(OptTTYPE, []byte{ttypeSEND})
+	case opt == OptMCCP2 && local && enabled:
+		return c.startCompression()
+	case opt == OptMCCP2 && local && !enabled:
+		return c.stopCompression()
+	}
+	return nil
+}
+
+func (c *Conn) notify(opt byte, local, enabled bool) {
+	c.mutex.RLock()
+	handlers := c.optHandlers
+	c.mutex.RUnlock()
+	for _, fn := range handlers {
+		fn(opt, local, enabled)
+	}
+}
+
+func (c *Conn) handleSubnegotiation(opt byte, data []byte) {
+	switch opt {
+	case OptNAWS:
+		c.handleNAWS(data)
+		return
+	case OptTTYPE:
+		c.handleTTYPE(data)
+		return
+	}
+
+	c.mutex.RLock()
+	fn := c.subHandlers[opt]
+	c.mutex.RUnlock()
+	if fn != nil {
+		// Hand the callback its own copy, our buffer is reused.
+		fn(append([]byte(nil), data...))
+	}
+}
+
+// handleNAWS records the client window size.
+func (c *Conn) handleNAWS(data []byte) {
+	if len(data) != 4 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.width = int(data[0])<<8 | int(data[1])
+	c.height = int(data[2])<<8 | int(data[3])
+}
+
+// handleTTYPE records a terminal type and cycles through the client's list,
+// picking up the MTTS bit vector if the client supports it.
+func (c *Conn) handleTTYPE(data []byte) {
+	if len(data) < 1 || data[0] != ttypeIS {
+		return
+	}
+	name := string(data[1:])
+
+	c.mutex.Lock()
+	// A repeated type means the client has run out of types to report.
+	if len(c.ttypes) > 0 && c.ttypes[len(c.ttypes)-1] == name {
+		c.mutex.Unlock()
+		return
+	}
+	if strings.HasPrefix(name, "MTTS ") {
+		if v, err := strconv.Atoi(strings.TrimPrefix(name, "MTTS ")); err == nil {
+			c.mtts = v
+		}
+		c.mutex.Unlock()
+		return
+	}
+	c.ttypes = append(c.ttypes, name)
+	again := len(c.ttypes) < maxTTYPERequests
+	c.mutex.Unlock()
+
+	if again {
+		c.Subnegotiate(OptTTYPE, []byte{ttypeSEND})
+	}
+}
+
+// StripCommands removes all telnet commands and subnegotiations from a
+// buffer of outbound data, for sending to clients that don't speak telnet.
+// Sequences are expected to be whole within the buffer.
+func StripCommands(data []byte) []byte {
+	if bytes.IndexByte(data, IAC) < 0 {
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] != IAC {
+			out = append(out, data[i])
+			continue
+		}
+		i++
+		if i >= len(data) {
+			break
+		}
+		switch data[i] {
+		case IAC:
+			out = append(out, IAC)
+		case WILL, WONT, DO, DONT:
+			// Skip the option byte.
+			i++
+		case SB:
+			// Skip everything up to and including IAC SE.
+			for i++; i < len(data); i++ {
+				if data[i] == IAC && i+1 < len(data) && data[i+1] == SE {
+					i++
+					break
+				}
+			}
+		}
+	}
+	return out
+}
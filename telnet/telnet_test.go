@@ -0,0 +1,221 @@
+package telnet
+
+import (
+	"bufio"
+	"compress/zlib"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testConn(t *testing.T) (*Conn, net.Conn) {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return NewConn(server), client
+}
+
+// readReply reads exactly n bytes from the client side of a pipe.
+func readReply(t *testing.T, c net.Conn, n int) []byte {
+	t.Helper()
+	buf := make([]byte, n)
+	_, err := io.ReadFull(c, buf)
+	assert.NoError(t, err)
+	return buf
+}
+
+// testSync waits for everything the client has sent so far to be handled,
+// by asking for an unknown option and waiting on the refusal.
+func testSync(t *testing.T, client net.Conn) {
+	t.Helper()
+	client.Write([]byte{IAC, DO, 99})
+	assert.Equal(t, []byte{IAC, WONT, 99}, readReply(t, client, 3))
+}
+
+func TestReadStripsCommands(t *testing.T) {
+	c, client := testConn(t)
+	go func() {
+		client.Write([]byte{'l', IAC, NOP, 'o', IAC, IAC, 'o', IAC, GA, 'k', '\r', 0, '\n'})
+	}()
+	line, err := bufio.NewReader(c).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "lo\xffok\r\n", line)
+}
+
+func TestNegotiateAcceptsSupportedOptions(t *testing.T) {
+	c, client := testConn(t)
+	go c.Read(make([]byte, 1))
+
+	// We never offered SGA, so agreeing to it must be answered.
+	client.Write([]byte{IAC, DO, OptSGA})
+	assert.Equal(t, []byte{IAC, WILL, OptSGA}, readReply(t, client, 3))
+	assert.True(t, c.LocalEnabled(OptSGA))
+
+	// Unknown options are refused.
+	client.Write([]byte{IAC, DO, 99})
+	assert.Equal(t, []byte{IAC, WONT, 99}, readReply(t, client, 3))
+	client.Write([]byte{IAC, WILL, 99})
+	assert.Equal(t, []byte{IAC, DONT, 99}, readReply(t, client, 3))
+}
+
+func TestEchoOnlyWhenRequested(t *testing.T) {
+	c, client := testConn(t)
+	go c.Read(make([]byte, 1))
+
+	client.Write([]byte{IAC, DO, OptEcho})
+	assert.Equal(t, []byte{IAC, WONT, OptEcho}, readReply(t, client, 3))
+	assert.True(t, c.State().Echo)
+
+	go c.SetEcho(false)
+	assert.Equal(t, []byte{IAC, WILL, OptEcho}, readReply(t, client, 3))
+	client.Write([]byte{IAC, DO, OptEcho})
+	go c.SetEcho(true)
+	assert.Equal(t, []byte{IAC, WONT, OptEcho}, readReply(t, client, 3))
+}
+
+func TestEchoChangedWhileWaiting(t *testing.T) {
+	c, client := testConn(t)
+	go c.Read(make([]byte, 1))
+
+	// Echo is turned back on before the client agrees to turn it off, so
+	// the agreement is answered by turning it straight back on.
+	go c.SetEcho(false)
+	assert.Equal(t, []byte{IAC, WILL, OptEcho}, readReply(t, client, 3))
+	assert.NoError(t, c.SetEcho(true))
+	client.Write([]byte{IAC, DO, OptEcho})
+	assert.Equal(t, []byte{IAC, WONT, OptEcho}, readReply(t, client, 3))
+	client.Write([]byte{IAC, DONT, OptEcho})
+	testSync(t, client)
+	assert.True(t, c.State().Echo)
+
+	// And the other way around, turning echo off again while the client
+	// is yet to agree to turning it on.
+	go c.SetEcho(false)
+	assert.Equal(t, []byte{IAC, WILL, OptEcho}, readReply(t, client, 3))
+	client.Write([]byte{IAC, DO, OptEcho})
+	testSync(t, client)
+	assert.False(t, c.State().Echo)
+	go c.SetEcho(true)
+	assert.Equal(t, []byte{IAC, WONT, OptEcho}, readReply(t, client, 3))
+	assert.NoError(t, c.SetEcho(false))
+	client.Write([]byte{IAC, DONT, OptEcho})
+	assert.Equal(t, []byte{IAC, WILL, OptEcho}, readReply(t, client, 3))
+	client.Write([]byte{IAC, DO, OptEcho})
+	testSync(t, client)
+	assert.False(t, c.State().Echo)
+}
+
+func TestNAWS(t *testing.T) {
+	c, client := testConn(t)
+	go func() {
+		client.Write([]byte{IAC, SB, OptNAWS, 0, 80, 0, 24, IAC, SE, 'x'})
+	}()
+	buf := make([]byte, 1)
+	_, err := c.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "x", string(buf))
+	s := c.State()
+	assert.Equal(t, 80, s.Width)
+	assert.Equal(t, 24, s.Height)
+}
+
+func TestTTYPECycle(t *testing.T) {
+	c, client := testConn(t)
+	go c.Read(make([]byte, 1))
+
+	go c.EnableRemote(OptTTYPE)
+	assert.Equal(t, []byte{IAC, DO, OptTTYPE}, readReply(t, client, 3))
+	client.Write([]byte{IAC, WILL, OptTTYPE})
+	send := []byte{IAC, SB, OptTTYPE, ttypeSEND, IAC, SE}
+	assert.Equal(t, send, readReply(t, client, len(send)))
+
+	for _, name := range []string{"MUDLET", "ANSI-256COLOR"} {
+		client.Write(append(append([]byte{IAC, SB, OptTTYPE, ttypeIS}, name...), IAC, SE))
+		assert.Equal(t, send, readReply(t, client, len(send)))
+	}
+	client.Write(append(append([]byte{IAC, SB, OptTTYPE, ttypeIS}, "MTTS 137"...), IAC, SE))
+	// Flush the parser with a noop so the state is settled.
+	client.Write([]byte{IAC, NOP})
+
+	s := c.State()
+	assert.Equal(t, "MUDLET", s.Client)
+	assert.Equal(t, "ANSI-256COLOR", s.Terminal)
+	assert.Equal(t, 137, s.MTTS)
+}
+
+func TestPromptEnd(t *testing.T) {
+	c, client := testConn(t)
+	go c.Read(make([]byte, 1))
+	assert.Equal(t, string([]byte{IAC, GA}), c.PromptEnd())
+
+	go c.EnableLocal(OptEOR)
+	readReply(t, client, 3)
+	client.Write([]byte{IAC, DO, OptEOR})
+	client.Write([]byte{IAC, NOP})
+	assert.Equal(t, string([]byte{IAC, EOR}), c.PromptEnd())
+}
+
+func TestParseGMCP(t *testing.T) {
+	message, payload := ParseGMCP([]byte(`Core.Supports.Set ["Char 1", "Room 1"]`))
+	assert.Equal(t, "Core.Supports.Set", message)
+	assert.Equal(t, `["Char 1", "Room 1"]`, string(payload))
+
+	message, payload = ParseGMCP([]byte("Core.Ping"))
+	assert.Equal(t, "Core.Ping", message)
+	assert.Nil(t, payload)
+}
+
+func TestCompression(t *testing.T) {
+	c, client := testConn(t)
+	go c.Read(make([]byte, 1))
+
+	go c.SetCompression(true)
+	assert.Equal(t, []byte{IAC, WILL, OptMCCP2}, readReply(t, client, 3))
+	client.Write([]byte{IAC, DO, OptMCCP2})
+	start := []byte{IAC, SB, OptMCCP2, IAC, SE}
+	assert.Equal(t, start, readReply(t, client, len(start)))
+
+	go func() {
+		c.Write([]byte("hello"))
+		c.SetCompression(false)
+	}()
+	// Hand zlib a buffered reader so it doesn't wrap the pipe in its own
+	// buffer, which would swallow what follows the compressed stream.
+	r := bufio.NewReader(client)
+	z, err := zlib.NewReader(r)
+	assert.NoError(t, err)
+	text, err := io.ReadAll(z)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(text))
+	wont := make([]byte, 3)
+	_, err = io.ReadFull(r, wont)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{IAC, WONT, OptMCCP2}, wont)
+	assert.False(t, c.Compressing())
+}
+
+func TestStripCommands(t *testing.T) {
+	data := []byte{'h', 'i', '\r', IAC, GA, IAC, WILL, OptEcho, IAC, SB, OptGMCP, 'x', IAC, IAC, IAC, SE, IAC, IAC, '!'}
+	assert.Equal(t, "hi\r\xff!", string(StripCommands(data)))
+	assert.Equal(t, "plain", string(StripCommands([]byte("plain"))))
+}
+
+func TestRestore(t *testing.T) {
+	c, _ := testConn(t)
+	c.Restore(State{SGA: true, EOR: true, Echo: true, NAWS: true, Width: 120, Height: 50, Client: "MUDLET", MTTS: 137})
+	s := c.State()
+	assert.True(t, s.SGA)
+	assert.True(t, s.EOR)
+	assert.True(t, s.Echo)
+	assert.False(t, s.MCCP)
+	assert.Equal(t, 120, s.Width)
+	assert.Equal(t, "MUDLET", s.Client)
+	assert.Equal(t, 137, s.MTTS)
+	assert.True(t, c.RemoteEnabled(OptTTYPE))
+	assert.Equal(t, string([]byte{IAC, EOR}), c.PromptEnd())
+}
@@ -3,11 +3,13 @@ package util
 import (
 	"os"
 	"os/signal"
+	"syscall"
 )
 
-// WaitForSigInt waits for... sigint
-func SigIntChannel() chan os.Signal {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+// ShutdownChannel returns a channel that receives a signal when the process
+// is asked to shut down, either by interrupt or terminate.
+func ShutdownChannel() chan os.Signal {
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	return c
 }